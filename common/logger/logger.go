@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level 日志级别
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff // 不输出任何日志
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "OFF"
+}
+
+// Field 结构化日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 创建日志字段
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err 创建key为err的日志字段
+func Err(err error) Field {
+	return Field{Key: "err", Value: err}
+}
+
+// Logger 分级日志接口, 可以适配zap/logrus等日志库
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+// Default 默认日志, 只输出warn及以上级别到标准库log
+func Default() Logger {
+	return NewStdLogger(nil, LevelWarn)
+}
+
+// Nop 丢弃所有日志
+func Nop() Logger {
+	return NewStdLogger(nil, LevelOff)
+}
+
+// NewStdLogger 基于标准库log的Logger, 低于level的日志不输出, l为nil时使用log包的默认输出
+func NewStdLogger(l *log.Logger, level Level) Logger {
+	return &stdLogger{l: l, level: level}
+}
+
+type stdLogger struct {
+	l     *log.Logger
+	level Level
+}
+
+func (s *stdLogger) Debug(msg string, fields ...Field) { s.output(LevelDebug, msg, fields) }
+func (s *stdLogger) Info(msg string, fields ...Field)  { s.output(LevelInfo, msg, fields) }
+func (s *stdLogger) Warn(msg string, fields ...Field)  { s.output(LevelWarn, msg, fields) }
+func (s *stdLogger) Error(msg string, fields ...Field) { s.output(LevelError, msg, fields) }
+
+func (s *stdLogger) output(level Level, msg string, fields []Field) {
+	if level < s.level {
+		return
+	}
+
+	line := format(level, msg, fields)
+	if s.l == nil {
+		log.Output(3, line)
+		return
+	}
+	s.l.Output(3, line)
+}
+
+// format 格式化为: [LEVEL] msg key=value key=value, 含空白的值加引号
+func format(level Level, msg string, fields []Field) string {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	buf.WriteString(level.String())
+	buf.WriteString("] ")
+	buf.WriteString(msg)
+	for _, f := range fields {
+		v := fmt.Sprintf("%v", f.Value)
+		if len(v) == 0 || strings.ContainsAny(v, " \t\r\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		buf.WriteString(" ")
+		buf.WriteString(f.Key)
+		buf.WriteString("=")
+		buf.WriteString(v)
+	}
+	return buf.String()
+}
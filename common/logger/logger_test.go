@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestStdLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelWarn)
+
+	l.Debug("debug")
+	l.Info("info")
+	if buf.Len() != 0 {
+		t.Fatalf("below level should be dropped, got %q", buf.String())
+	}
+
+	l.Warn("warn")
+	l.Error("error")
+	if got, want := buf.String(), "[WARN] warn\n[ERROR] error\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestStdLoggerFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelDebug)
+
+	l.Info("slave add", F("master", "mymaster"), F("host", "127.0.0.1:6380"), F("empty", ""), Err(errors.New("i/o timeout")))
+	want := `[INFO] slave add master=mymaster host=127.0.0.1:6380 empty="" err="i/o timeout"` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestNop(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Nop().Error("error")
+	if buf.Len() != 0 {
+		t.Fatalf("nop logger wrote %q", buf.String())
+	}
+}
@@ -1,7 +1,6 @@
 package monitor
 
 import (
-	"log"
 	"os"
 	"runtime"
 	"strconv"
@@ -27,16 +26,28 @@ func newMachine() *MachineInfo {
 	return m
 }
 
-func (info *MachineInfo) GetInfo() (r map[string]interface{}) {
-	var err error
+// GetInfo 采集机器和进程信息, 采集失败的项为零值
+func (info *MachineInfo) GetInfo() map[string]interface{} {
+	r, _ := info.collect()
+	return r
+}
+
+// collect 采集机器和进程信息, 返回第一个采集错误
+func (info *MachineInfo) collect() (r map[string]interface{}, err error) {
 	r = make(map[string]interface{})
 
-	err = info.mem.Get()
+	keepErr := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+
+	keepErr(info.mem.Get())
 	runtime.ReadMemStats(&info.pMem)
 	cpuOld := info.cpu
-	err = info.cpu.Get()
+	keepErr(info.cpu.Get())
 	cpuDiff := info.cpu.Delta(cpuOld)
-	err = info.pCpu.Get(info.pid)
+	keepErr(info.pCpu.Get(info.pid))
 	r["systemCpuSize"] = strconv.FormatInt(int64(info.cpuSize), 10)
 
 	sysCpuPct := float64(cpuDiff.Total()-cpuDiff.Idle) / float64(cpuDiff.Total())
@@ -49,8 +60,5 @@ func (info *MachineInfo) GetInfo() (r map[string]interface{}) {
 	r["processMemSize"] = strconv.FormatUint(info.pMem.Sys, 10)
 	r["processMemUsage"] = strconv.FormatUint(info.pMem.Alloc, 10)
 
-	if err != nil {
-		log.Println(err)
-	}
 	return
 }
@@ -2,8 +2,9 @@ package monitor
 
 import (
 	"errors"
-	"log"
 	"time"
+
+	"gzoo/common/logger"
 )
 
 type Monitor interface {
@@ -36,10 +37,14 @@ func (m *monitor) Init(opts ...Option) Monitor {
 		o(&m.opts)
 	}
 
+	if m.opts.Logger == nil {
+		m.opts.Logger = logger.Default()
+	}
+
 	m.report = m.opts.ReporterFunc
 	m.stop = make(chan struct{}, 1)
 
-	log.Println("monitor init")
+	m.opts.Logger.Info("monitor init", logger.F("service", m.opts.ServiceName))
 
 	return m
 }
@@ -57,10 +62,10 @@ func (m *monitor) Run() error {
 			select {
 			case <-t.C:
 				if err = m.report.Report(m.opts); err != nil {
-					log.Println("report data err:", err.Error())
+					m.opts.Logger.Warn("report data err", logger.Err(err))
 				}
 			case <-m.stop:
-				log.Println("monitor stop")
+				m.opts.Logger.Info("monitor stop")
 				return
 			}
 		}
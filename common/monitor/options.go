@@ -1,6 +1,10 @@
 package monitor
 
-import "time"
+import (
+	"time"
+
+	"gzoo/common/logger"
+)
 
 var (
 	defaultOptions = Options{
@@ -10,6 +14,7 @@ var (
 		AgentReportPort: 9090,
 		HttpReportUrl:   "http://127.0.0.1:8080/monitor/data",
 		ReporterFunc:    NewHttpReporter(), //默认http
+		Logger:          logger.Default(),
 	}
 )
 
@@ -22,6 +27,7 @@ type Options struct {
 	AgentReportIp   string        //agent上报方式的ip
 	AgentReportPort int           //agent上报方式的port
 	HttpReportUrl   string        //http上报方式url
+	Logger          logger.Logger //日志, 默认只输出warn及以上
 }
 
 func MachineName(serviceName string) Option {
@@ -71,3 +77,9 @@ func HttpReportUrl(httpReportUrl string) Option {
 		o.HttpReportUrl = httpReportUrl
 	}
 }
+
+func Logger(l logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+
+	"gzoo/common/logger"
 )
 
 type Reporter interface {
@@ -34,7 +36,10 @@ func NewHttpReporter() Reporter {
 }
 
 func (h *httpReporter) Report(opts Options) error {
-	info := h.machineInfo.GetInfo()
+	info, err := h.machineInfo.collect()
+	if err != nil && opts.Logger != nil {
+		opts.Logger.Warn("collect machine info err", logger.Err(err))
+	}
 	if info == nil {
 		return errInfoEmpty
 	}
@@ -84,7 +89,10 @@ func NewAgentReporter(opts Options) Reporter {
 }
 
 func (r *agentReporter) Report(opts Options) error {
-	info := r.machineInfo.GetInfo()
+	info, err := r.machineInfo.collect()
+	if err != nil && opts.Logger != nil {
+		opts.Logger.Warn("collect machine info err", logger.Err(err))
+	}
 	if info == nil {
 		return errInfoEmpty
 	}
@@ -0,0 +1,174 @@
+package sentinelClient
+
+import (
+	"context"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// Batch 批量命令, 由ExecBatch按读写分到master/slave后流水线执行, 不是事务
+type Batch struct {
+	cmds []batchCmd
+}
+
+type batchCmd struct {
+	name string
+	args []interface{}
+}
+
+// BatchResult 一条命令的执行结果
+type BatchResult struct {
+	Reply interface{}
+	Err   error
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Add 添加一条命令, 结果在ExecBatch返回值中的下标和添加顺序一致
+func (b *Batch) Add(cmd string, args ...interface{}) *Batch {
+	b.cmds = append(b.cmds, batchCmd{name: cmd, args: args})
+	return b
+}
+
+// Len 命令数
+func (b *Batch) Len() int {
+	return len(b.cmds)
+}
+
+// ExecBatch 执行批量命令, 返回和添加顺序一致的每条命令结果
+// 只读命令在slave上执行, 其他命令和ForceMaster(ctx)时在master上执行, 每batchChunkSize条命令一次流水线
+// 全是只读命令的一侧遇到主从切换时按重试策略整体重试, 包含写命令的一侧不重试
+// 只有客户端已关闭或master-name未知时返回error, 命令的错误在结果中
+func (s *sentinelClient) ExecBatch(ctx context.Context, masterName string, b *Batch) ([]BatchResult, error) {
+	if s.isClosed() {
+		return nil, errClosed
+	}
+
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return nil, err
+	}
+
+	var masterIdx, slaveIdx []int
+	force := isForceMaster(ctx)
+	for i, c := range b.cmds {
+		if !force && s.isReadOnlyCommand(c.name) {
+			slaveIdx = append(slaveIdx, i)
+		} else {
+			masterIdx = append(masterIdx, i)
+		}
+	}
+
+	results := make([]BatchResult, len(b.cmds))
+	s.execBatchWithRetry(ctx, g, b.cmds, masterIdx, false, results)
+	s.execBatchWithRetry(ctx, g, b.cmds, slaveIdx, true, results)
+	return results, nil
+}
+
+// execBatchWithRetry 执行下标为idx的命令, 全是只读命令时按重试策略整体重试
+func (s *sentinelClient) execBatchWithRetry(ctx context.Context, g *masterGroup, cmds []batchCmd, idx []int, toSlave bool, results []BatchResult) {
+	if len(idx) == 0 {
+		return
+	}
+
+	readOnly := toSlave
+	if !readOnly {
+		readOnly = true
+		for _, i := range idx {
+			if !s.isReadOnlyCommand(cmds[i].name) {
+				readOnly = false
+				break
+			}
+		}
+	}
+
+	policy := s.options.retryPolicy
+	for attempt := 0; ; attempt++ {
+		swapped := g.masterSwapped()
+
+		kind := s.execBatch(ctx, g, cmds, idx, toSlave, results)
+		if kind == errKindNone || !readOnly || attempt >= policy.MaxRetries {
+			return
+		}
+
+		if !toSlave && (kind == errKindReadOnly || kind == errKindConn) {
+			s.reResolveMaster(g)
+		}
+
+		s.options.logger.Debug("retry batch", logger.F("master", g.name), logger.F("cmds", len(idx)),
+			logger.F("attempt", attempt+1))
+		if !waitRetry(ctx, swapped, policy.backoff(attempt)) {
+			return
+		}
+	}
+}
+
+// execBatch 按batchChunkSize分段流水线执行, 返回第一个需要重试的错误分类
+func (s *sentinelClient) execBatch(ctx context.Context, g *masterGroup, cmds []batchCmd, idx []int, toSlave bool, results []BatchResult) errorKind {
+	size := s.options.batchChunkSize
+	if size <= 0 {
+		size = len(idx)
+	}
+
+	retryKind := errKindNone
+	for start := 0; start < len(idx); start += size {
+		end := start + size
+		if end > len(idx) {
+			end = len(idx)
+		}
+		chunk := idx[start:end]
+
+		if err := s.pipeline(ctx, g, toSlave, cmds, chunk, results); err != nil {
+			if kind := classifyError(err); retryKind == errKindNone {
+				retryKind = kind
+			}
+			continue
+		}
+		for _, i := range chunk {
+			if kind := classifyError(results[i].Err); kind != errKindNone && retryKind == errKindNone {
+				retryKind = kind
+			}
+		}
+	}
+	return retryKind
+}
+
+// pipeline 借一个连接流水线执行一段命令, 命令错误记在结果中, 连接错误时没有结果的命令都记为该错误并返回
+func (s *sentinelClient) pipeline(ctx context.Context, g *masterGroup, toSlave bool, cmds []batchCmd, chunk []int, results []BatchResult) (err error) {
+	received := 0
+	defer func() {
+		if err != nil {
+			for _, i := range chunk[received:] {
+				results[i] = BatchResult{Err: err}
+			}
+		}
+	}()
+
+	conn, err := s.routeConn(ctx, g, toSlave)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, i := range chunk {
+		if err = conn.Send(cmds[i].name, cmds[i].args...); err != nil {
+			return err
+		}
+	}
+	if err = conn.Flush(); err != nil {
+		return err
+	}
+
+	for _, i := range chunk {
+		reply, err := conn.Receive()
+		if _, ok := err.(redis.Error); err != nil && !ok {
+			return err
+		}
+		results[i] = BatchResult{Reply: reply, Err: err}
+		received++
+	}
+	return nil
+}
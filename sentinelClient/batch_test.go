@@ -0,0 +1,112 @@
+package sentinelClient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestSentinelClient_ExecBatch(t *testing.T) {
+	var masterGets, slaveGets int32
+	m := newFakeServer(t, countingRedis("master", &masterGets))
+	defer m.close()
+	r := newFakeServer(t, countingRedis("slave", &slaveGets))
+	defer r.close()
+
+	s := newTestClient("mymaster", m.addr(), BatchChunkSize(2))
+	defer s.Close(context.Background())
+	s.groups["mymaster"].slaves.update(map[string]replicaProbe{r.addr(): {lagOffset: -1, lagSeconds: -1}}, s.createRedisPool)
+
+	b := NewBatch().
+		Add("GET", "a").
+		Add("SET", "a", "1").
+		Add("GET", "b").
+		Add("UNKNOWN").
+		Add("GET", "c")
+	results, err := s.ExecBatch(context.Background(), "mymaster", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != b.Len() {
+		t.Fatalf("results = %d, want %d", len(results), b.Len())
+	}
+
+	for _, i := range []int{0, 2, 4} {
+		if reply, err := redis.String(results[i].Reply, results[i].Err); err != nil || reply != "slave" {
+			t.Fatalf("results[%d] = %v, %v, want from slave", i, reply, err)
+		}
+	}
+	if reply, err := redis.String(results[1].Reply, results[1].Err); err != nil || reply != "OK" {
+		t.Fatalf("results[1] = %v, %v", reply, err)
+	}
+	// 单条命令出错不影响其他命令
+	if _, ok := results[3].Err.(redis.Error); !ok {
+		t.Fatalf("results[3].Err = %v, want redis error", results[3].Err)
+	}
+	if masterGets != 0 || slaveGets != 3 {
+		t.Fatalf("gets master/slave = %d/%d, want 0/3", masterGets, slaveGets)
+	}
+
+	// ForceMaster时全部在master上执行
+	if _, err = s.ExecBatch(ForceMaster(context.Background()), "mymaster", b); err != nil {
+		t.Fatal(err)
+	}
+	if masterGets != 3 {
+		t.Fatalf("master gets = %d, want 3", masterGets)
+	}
+}
+
+func TestSentinelClient_ExecBatchRetry(t *testing.T) {
+	var gets, incrs int32
+	m := newFakeServer(t, func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			// 第一次整批都在加载数据
+			if atomic.AddInt32(&gets, 1) <= 2 {
+				return errors.New("LOADING Redis is loading the dataset in memory")
+			}
+			return []byte("v")
+		case "INCR":
+			atomic.AddInt32(&incrs, 1)
+			return errCloseConn
+		}
+		return fakeRedis("master")(args)
+	})
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr(), Retry(RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond}))
+	defer s.Close(context.Background())
+
+	// 没有slave时只读命令在master上执行, 全是只读命令时整体重试
+	results, err := s.ExecBatch(context.Background(), "mymaster", NewBatch().Add("GET", "a").Add("GET", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if reply, err := redis.String(res.Reply, res.Err); err != nil || reply != "v" {
+			t.Fatalf("results[%d] = %v, %v", i, reply, err)
+		}
+	}
+	if n := atomic.LoadInt32(&gets); n != 4 {
+		t.Fatalf("GET sent %d times, want 4", n)
+	}
+
+	// 包含写命令时连接断开不重试, 没有回复的命令都记为连接错误
+	results, err = s.ExecBatch(context.Background(), "mymaster", NewBatch().Add("INCR", "a").Add("INCR", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if classifyError(res.Err) != errKindConn {
+			t.Fatalf("results[%d].Err = %v, want connection error", i, res.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&incrs); n != 1 {
+		t.Fatalf("INCR received %d times, want 1", n)
+	}
+}
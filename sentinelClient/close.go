@@ -0,0 +1,125 @@
+package sentinelClient
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// drainCheckInterval 关闭时检查借出连接是否归还的间隔
+const drainCheckInterval = 10 * time.Millisecond
+
+// Close 关闭sentinelClient, 停止后台goroutine, 取消订阅, 等借出的连接在ctx截止前归还后关闭连接池
+// 关闭后Get*Client返回errClosed, ctx截止时仍有连接未归还返回ctx.Err(), 连接池照常关闭
+func (s *sentinelClient) Close(ctx context.Context) error {
+	s.closeMutex.Lock()
+	if s.closed {
+		s.closeMutex.Unlock()
+		return errClosed
+	}
+	s.closed = true
+	if s.stop != nil {
+		close(s.stop)
+	}
+	s.closeMutex.Unlock()
+
+	// 关闭订阅连接, subSentinelEvent的Receive随之返回
+	// 不发PUNSUBSCRIBE, 定时检测可能正在同一连接上ping, 连接关闭后sentinel自动取消订阅
+	pubSubConn := s.getPubSubConn()
+	if pubSubConn.Conn != nil {
+		pubSubConn.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err == nil {
+		err = s.drainConns(ctx)
+	}
+
+	for _, g := range s.groups {
+		g.master.poolMutex.Lock()
+		if g.master.poolGen != nil {
+			g.master.poolGen.pool.Close()
+		}
+		g.master.poolMutex.Unlock()
+		g.slaves.close()
+		g.probes.close()
+	}
+
+	return err
+}
+
+// drainConns 等待所有借出的连接归还
+func (s *sentinelClient) drainConns(ctx context.Context) error {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		n := s.borrowedConns()
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.options.logger.Warn("sentinel client close, connections not returned", logger.F("conns", n))
+			return ctx.Err()
+		}
+	}
+}
+
+// borrowedConns 所有连接池借出未归还的连接数
+func (s *sentinelClient) borrowedConns() int {
+	var n int
+	for _, g := range s.groups {
+		g.master.poolMutex.RLock()
+		if g.master.poolGen != nil {
+			n += borrowed(g.master.poolGen.pool)
+		}
+		g.master.poolMutex.RUnlock()
+		n += g.slaves.borrowed()
+	}
+	return n
+}
+
+func borrowed(pool *redis.Pool) int {
+	stats := pool.Stats()
+	return stats.ActiveCount - stats.IdleCount
+}
+
+func (s *sentinelClient) isClosed() bool {
+	s.closeMutex.RLock()
+	defer s.closeMutex.RUnlock()
+	return s.closed
+}
+
+// goroutine 启动后台goroutine, Close时等待其退出, 已关闭时不再启动并返回false
+func (s *sentinelClient) goroutine(f func()) bool {
+	s.closeMutex.RLock()
+	defer s.closeMutex.RUnlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		f()
+	}()
+	return true
+}
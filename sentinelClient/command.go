@@ -0,0 +1,97 @@
+package sentinelClient
+
+import (
+	"context"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// readOnlyCommands 内置的只读命令表, 获取不到COMMAND时使用
+var readOnlyCommands = map[string]bool{
+	"GET": true, "MGET": true, "EXISTS": true, "TTL": true, "PTTL": true, "TYPE": true, "STRLEN": true,
+	"GETRANGE": true, "HGET": true, "HMGET": true, "HGETALL": true, "HKEYS": true, "HVALS": true,
+	"HLEN": true, "HEXISTS": true, "HSTRLEN": true, "LRANGE": true, "LLEN": true, "LINDEX": true,
+	"SMEMBERS": true, "SISMEMBER": true, "SCARD": true, "SRANDMEMBER": true, "SUNION": true,
+	"SINTER": true, "SDIFF": true, "ZRANGE": true, "ZRANGEBYSCORE": true, "ZRANGEBYLEX": true,
+	"ZREVRANGE": true, "ZREVRANGEBYSCORE": true, "ZREVRANGEBYLEX": true, "ZSCORE": true,
+	"ZCARD": true, "ZRANK": true, "ZREVRANK": true, "ZCOUNT": true, "ZLEXCOUNT": true,
+	"SCAN": true, "HSCAN": true, "SSCAN": true, "ZSCAN": true, "KEYS": true, "RANDOMKEY": true,
+	"DBSIZE": true, "BITCOUNT": true, "BITPOS": true, "GETBIT": true, "PFCOUNT": true,
+	"GEOPOS": true, "GEODIST": true, "GEOHASH": true, "XRANGE": true, "XREVRANGE": true, "XLEN": true,
+}
+
+// commandTable 命令名(大写)是否只读, 来自redis的COMMAND
+type commandTable map[string]bool
+
+// loadCommandTable 用COMMAND获取所有命令的flags, 带readonly的命令路由到slave
+func loadCommandTable(conn redis.Conn) (commandTable, error) {
+	commands, err := redis.Values(conn.Do("COMMAND"))
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(commandTable, len(commands))
+	for _, command := range commands {
+		// 格式: name arity flags first-key last-key step ...
+		info, err := redis.Values(command, nil)
+		if err != nil || len(info) < 3 {
+			continue
+		}
+		name, err := redis.String(info[0], nil)
+		if err != nil {
+			continue
+		}
+		flags, _ := redis.Strings(info[2], nil)
+
+		readOnly := false
+		for _, flag := range flags {
+			if flag == "readonly" {
+				readOnly = true
+				break
+			}
+		}
+		table[strings.ToUpper(name)] = readOnly
+	}
+	return table, nil
+}
+
+// initCommandTable 从master获取命令表, 失败时使用内置只读命令表
+func (s *sentinelClient) initCommandTable(g *masterGroup) error {
+	ctx, cancel := s.borrowContext()
+	defer cancel()
+
+	conn, err := s.getMasterConn(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	table, err := loadCommandTable(conn)
+	if err != nil {
+		return err
+	}
+	s.commands = table
+	return nil
+}
+
+// isReadOnlyCommand 命令是否只读, 命令表没有的命令按写命令处理
+func (s *sentinelClient) isReadOnlyCommand(cmd string) bool {
+	cmd = strings.ToUpper(cmd)
+	if s.commands != nil {
+		return s.commands[cmd]
+	}
+	return readOnlyCommands[cmd]
+}
+
+type forceMasterKey struct{}
+
+// ForceMaster 返回的ctx传给Do时, 只读命令也在master上执行, 用于需要读到最新写入的场景
+func ForceMaster(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceMasterKey{}, true)
+}
+
+func isForceMaster(ctx context.Context) bool {
+	force, _ := ctx.Value(forceMasterKey{}).(bool)
+	return force
+}
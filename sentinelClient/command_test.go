@@ -0,0 +1,82 @@
+package sentinelClient
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestLoadCommandTable(t *testing.T) {
+	srv := newFakeServer(t, func(args []string) interface{} {
+		if strings.EqualFold(args[0], "COMMAND") {
+			return []interface{}{
+				[]interface{}{[]byte("get"), int64(2), []interface{}{"readonly", "fast"}, int64(1), int64(1), int64(1)},
+				[]interface{}{[]byte("set"), int64(-3), []interface{}{"write", "denyoom"}, int64(1), int64(1), int64(1)},
+				[]interface{}{[]byte("myreadcmd"), int64(2), []interface{}{"readonly"}, int64(1), int64(1), int64(1)},
+			}
+		}
+		return fakeRedis("master")(args)
+	})
+	defer srv.close()
+
+	s := newTestClient("mymaster", srv.addr())
+	defer s.Close(context.Background())
+
+	// 没有命令表时用内置表
+	if !s.isReadOnlyCommand("hgetall") || s.isReadOnlyCommand("myreadcmd") || s.isReadOnlyCommand("SET") {
+		t.Fatal("builtin read only table mismatch")
+	}
+
+	if err := s.initCommandTable(s.groups["mymaster"]); err != nil {
+		t.Fatal(err)
+	}
+	if !s.isReadOnlyCommand("GET") || !s.isReadOnlyCommand("myreadcmd") || s.isReadOnlyCommand("set") {
+		t.Fatalf("command table = %v", s.commands)
+	}
+	// 命令表里没有的按写命令处理
+	if s.isReadOnlyCommand("hgetall") {
+		t.Fatal("unknown command should route to master")
+	}
+}
+
+// countingRedis 记录GET次数的redis实例
+func countingRedis(role string, n *int32) fakeHandler {
+	return func(args []string) interface{} {
+		if strings.EqualFold(args[0], "GET") {
+			atomic.AddInt32(n, 1)
+			return []byte(role)
+		}
+		return fakeRedis(role)(args)
+	}
+}
+
+func TestSentinelClient_DoReadWriteSplit(t *testing.T) {
+	var masterGets, slaveGets int32
+	m := newFakeServer(t, countingRedis("master", &masterGets))
+	defer m.close()
+	r := newFakeServer(t, countingRedis("slave", &slaveGets))
+	defer r.close()
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+	s.groups["mymaster"].slaves.update(map[string]replicaProbe{r.addr(): {lagOffset: -1, lagSeconds: -1}}, s.createRedisPool)
+
+	ctx := context.Background()
+	if reply, err := redis.String(s.Do(ctx, "mymaster", "GET", "k")); err != nil || reply != "slave" {
+		t.Fatalf("GET = %v, %v, want from slave", reply, err)
+	}
+	if reply, err := redis.String(s.Do(ForceMaster(ctx), "mymaster", "GET", "k")); err != nil || reply != "master" {
+		t.Fatalf("forced GET = %v, %v, want from master", reply, err)
+	}
+	// 写命令在master上执行, 在slave上会返回READONLY
+	if reply, err := redis.String(s.Do(ctx, "mymaster", "SET", "k", "v")); err != nil || reply != "OK" {
+		t.Fatalf("SET = %v, %v", reply, err)
+	}
+
+	if masterGets != 1 || slaveGets != 1 {
+		t.Fatalf("gets master/slave = %d/%d, want 1/1", masterGets, slaveGets)
+	}
+}
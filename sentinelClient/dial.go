@@ -0,0 +1,69 @@
+package sentinelClient
+
+import (
+	"crypto/tls"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// dialSentinel 连接sentinel, 配置了sentinel tls时使用tls, 配置了sentinel账号密码时认证
+// 默认读写超时为dialTimeout, 避免一个不响应的sentinel卡住切换和定时检测, options在默认之后生效
+func (s *sentinelClient) dialSentinel(host string, options ...redis.DialOption) (redis.Conn, error) {
+	options = append([]redis.DialOption{
+		redis.DialConnectTimeout(s.options.dialConnTimeout),
+		redis.DialReadTimeout(s.options.dialTimeout),
+		redis.DialWriteTimeout(s.options.dialTimeout),
+	}, options...)
+	options = append(options, tlsDialOptions(s.options.sentinelTLSConfig)...)
+
+	conn, err := redis.Dial("tcp", host, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = auth(conn, s.options.sentinelUsername, s.options.sentinelPassword); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialRedis 连接redis数据节点, RedisOptions在options之后生效, 配置了redis tls时使用tls, 配置了redis账号密码时认证
+func (s *sentinelClient) dialRedis(host string, options ...redis.DialOption) (redis.Conn, error) {
+	options = append(options, tlsDialOptions(s.options.redisTLSConfig)...)
+	options = append(options, s.options.redisOptions...)
+
+	conn, err := redis.Dial("tcp", host, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = auth(conn, s.options.redisUsername, s.options.redisPassword); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// tlsDialOptions config为nil时不使用tls
+func tlsDialOptions(config *tls.Config) []redis.DialOption {
+	if config == nil {
+		return nil
+	}
+	return []redis.DialOption{redis.DialUseTLS(true), redis.DialTLSConfig(config)}
+}
+
+// auth 认证, 有username时使用redis6 ACL的AUTH username password
+func auth(conn redis.Conn, username, password string) error {
+	if len(password) <= 0 {
+		return nil
+	}
+
+	var err error
+	if len(username) > 0 {
+		_, err = conn.Do("AUTH", username, password)
+	} else {
+		_, err = conn.Do("AUTH", password)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package sentinelClient
+
+import (
+	"testing"
+)
+
+func TestSentinelClient_DialAuth(t *testing.T) {
+	sentinel := newFakeAuthServer(t, "", "sentinel-pass", fakeSentinel("mymaster", "10.0.0.1:6379"))
+	data := newFakeAuthServer(t, "app", "redis-pass", fakeRedis("master"))
+	defer sentinel.close()
+	defer data.close()
+
+	s := &sentinelClient{options: defaultOptions}
+	if _, err := s.getMasterAddr(sentinel.addr(), "mymaster"); err == nil {
+		t.Fatal("want NOAUTH without sentinel password")
+	}
+	if err := s.verifyMasterRole(data.addr()); err == nil {
+		t.Fatal("want NOAUTH without redis password")
+	}
+
+	s.options.sentinelPassword = "sentinel-pass"
+	s.options.redisUsername, s.options.redisPassword = "app", "redis-pass"
+
+	addr, err := s.getMasterAddr(sentinel.addr(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "10.0.0.1:6379" {
+		t.Fatalf("addr = %s", addr)
+	}
+	if err = s.verifyMasterRole(data.addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据节点的账号密码不用于sentinel
+	s.options.sentinelPassword = ""
+	if _, err = s.getMasterAddr(sentinel.addr(), "mymaster"); err == nil {
+		t.Fatal("want NOAUTH, redis password must not be sent to sentinel")
+	}
+}
@@ -0,0 +1,106 @@
+package sentinelClient
+
+import (
+	"net"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// SentinelHosts 当前使用的sentinel host列表, 包括自动发现的sentinel
+func (s *sentinelClient) SentinelHosts() []string {
+	return s.getSentinelHosts()
+}
+
+func (s *sentinelClient) getSentinelHosts() []string {
+	s.sentinelMutex.RLock()
+	defer s.sentinelMutex.RUnlock()
+
+	hosts := make([]string, len(s.sentinelHosts))
+	copy(hosts, s.sentinelHosts)
+	return hosts
+}
+
+// addSentinelHosts 合并sentinel host, 返回新增的host
+func (s *sentinelClient) addSentinelHosts(hosts ...string) []string {
+	s.sentinelMutex.Lock()
+	defer s.sentinelMutex.Unlock()
+
+	var added []string
+	for _, host := range hosts {
+		if len(host) <= 0 || containsHost(s.sentinelHosts, host) {
+			continue
+		}
+		s.sentinelHosts = append(s.sentinelHosts, host)
+		added = append(added, host)
+	}
+	return added
+}
+
+// pruneSentinelHosts 删除不在live中的sentinel host, 配置的host不删除, 返回删除的host
+func (s *sentinelClient) pruneSentinelHosts(live []string) []string {
+	s.sentinelMutex.Lock()
+	defer s.sentinelMutex.Unlock()
+
+	var removed []string
+	hosts := s.sentinelHosts[:0]
+	for _, host := range s.sentinelHosts {
+		if containsHost(live, host) || containsHost(s.options.sentinelHosts, host) {
+			hosts = append(hosts, host)
+			continue
+		}
+		removed = append(removed, host)
+	}
+	s.sentinelHosts = hosts
+	return removed
+}
+
+// discoverSentinels 通过SENTINEL sentinels发现监控同一master的其他sentinel
+// 所有master-name都查询成功时, 删除已不再报告的自动发现的sentinel(运维替换掉的)
+func (s *sentinelClient) discoverSentinels(sentinelHost string) error {
+	conn, err := s.dialSentinel(sentinelHost)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// SENTINEL sentinels不包括被查询的sentinel自己
+	live := []string{sentinelHost}
+	for name := range s.groups {
+		resp, err := redis.Values(conn.Do("SENTINEL", "sentinels", name))
+		if err != nil {
+			return err
+		}
+
+		var hosts []string
+		for _, sentinel := range resp {
+			sentinelM, err := redis.StringMap(sentinel, nil)
+			if err != nil {
+				continue
+			}
+			if len(sentinelM["ip"]) <= 0 || len(sentinelM["port"]) <= 0 {
+				continue
+			}
+			hosts = append(hosts, net.JoinHostPort(sentinelM["ip"], sentinelM["port"]))
+		}
+
+		for _, host := range s.addSentinelHosts(hosts...) {
+			s.options.logger.Info("sentinel discovered", logger.F("master", name), logger.F("sentinel", host))
+		}
+		live = append(live, hosts...)
+	}
+
+	for _, host := range s.pruneSentinelHosts(live) {
+		s.options.logger.Info("sentinel removed", logger.F("sentinel", host))
+	}
+	return nil
+}
+
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package sentinelClient
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSentinelClient_AddSentinelHosts(t *testing.T) {
+	s := &sentinelClient{}
+	s.addSentinelHosts("127.0.0.1:26379", "127.0.0.1:26380")
+
+	added := s.addSentinelHosts("127.0.0.1:26380", "127.0.0.1:26381", "")
+	if !reflect.DeepEqual(added, []string{"127.0.0.1:26381"}) {
+		t.Fatalf("added = %v", added)
+	}
+
+	want := []string{"127.0.0.1:26379", "127.0.0.1:26380", "127.0.0.1:26381"}
+	if got := s.SentinelHosts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SentinelHosts() = %v, want %v", got, want)
+	}
+}
+
+func TestSentinelClient_DiscoverSentinels(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		reported = []string{"127.0.0.1:26380", "127.0.0.1:26381"}
+	)
+	sentinel := newFakeServer(t, func(args []string) interface{} {
+		if len(args) == 3 && strings.EqualFold(args[1], "sentinels") {
+			mutex.Lock()
+			defer mutex.Unlock()
+			resp := make([]interface{}, 0, len(reported))
+			for _, host := range reported {
+				ip, port, _ := net.SplitHostPort(host)
+				resp = append(resp, []string{"name", "runid-" + port, "ip", ip, "port", port, "flags", "sentinel"})
+			}
+			return resp
+		}
+		return fakeSentinel("mymaster", "127.0.0.1:6379")(args)
+	})
+	defer sentinel.close()
+
+	// 配置的sentinel暂时不可达也不删除
+	seeds := []string{sentinel.addr(), "127.0.0.1:26379"}
+	s := &sentinelClient{options: defaultOptions}
+	s.options.sentinelHosts = seeds
+	s.groups = map[string]*masterGroup{"mymaster": newMasterGroup("mymaster")}
+	s.addSentinelHosts(seeds...)
+
+	if err := s.discoverSentinels(sentinel.addr()); err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]string{}, seeds...), "127.0.0.1:26380", "127.0.0.1:26381")
+	if got := s.SentinelHosts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SentinelHosts() = %v, want %v", got, want)
+	}
+
+	// +sentinel事件新增, 没有监控的master-name忽略
+	s.handleSentinelEvent("+sentinel", "sentinel runid-26382 127.0.0.1 26382 @ mymaster 127.0.0.1 6379")
+	s.handleSentinelEvent("+sentinel", "sentinel runid-26383 127.0.0.1 26383 @ other 127.0.0.1 6380")
+	want = append(want, "127.0.0.1:26382")
+	if got := s.SentinelHosts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SentinelHosts() = %v, want %v", got, want)
+	}
+
+	// 被替换掉的sentinel不再报告时删除
+	mutex.Lock()
+	reported = []string{"127.0.0.1:26381", "127.0.0.1:26384"}
+	mutex.Unlock()
+	if err := s.discoverSentinels(sentinel.addr()); err != nil {
+		t.Fatal(err)
+	}
+	want = append(append([]string{}, seeds...), "127.0.0.1:26381", "127.0.0.1:26384")
+	if got := s.SentinelHosts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SentinelHosts() = %v, want %v", got, want)
+	}
+
+	// 查询失败时不删除
+	sentinel.close()
+	if err := s.discoverSentinels(sentinel.addr()); err == nil {
+		t.Fatal("want dial error")
+	}
+	if got := s.SentinelHosts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SentinelHosts() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package sentinelClient
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// Do 执行命令, 只读命令在slave上执行, 其他命令和ForceMaster(ctx)时在master上执行
+// 遇到READONLY/LOADING/MASTERDOWN时命令未执行, 等新master或退避后重试
+// sentinel报告master下线(+odown/+try-failover)期间不发往master, 等新master, 重试到上限返回errMasterDown
+// 下线标记在-odown/切换中止/切换完成时清除, 订阅重连和定时检测时按SENTINEL master的标记校正
+// 连接断开时命令可能已执行, 只重试幂等命令
+func (s *sentinelClient) Do(ctx context.Context, masterName, cmd string, args ...interface{}) (interface{}, error) {
+	if s.isClosed() {
+		return nil, errClosed
+	}
+
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return nil, err
+	}
+
+	toSlave := !isForceMaster(ctx) && s.isReadOnlyCommand(cmd)
+	return s.doWithRetry(ctx, g, cmd, args, toSlave)
+}
+
+// doWithRetry 借连接执行命令, 按重试策略重试, toSlave为true时在slave上执行
+func (s *sentinelClient) doWithRetry(ctx context.Context, g *masterGroup, cmd string, args []interface{}, toSlave bool) (interface{}, error) {
+	// 只读命令都可以重试
+	idempotent := toSlave || s.options.retryPolicy.idempotent(cmd, args)
+	return s.retry(ctx, g, toSlave, idempotent, cmd, func(conn redis.Conn) (interface{}, error) {
+		return conn.Do(cmd, args...)
+	})
+}
+
+// retry 借连接执行f, 按重试策略重试, name用于日志
+func (s *sentinelClient) retry(ctx context.Context, g *masterGroup, toSlave, idempotent bool, name string,
+	f func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	policy := s.options.retryPolicy
+	for attempt := 0; ; attempt++ {
+		swapped := g.masterSwapped()
+
+		reply, sent, err := s.doOnce(ctx, g, toSlave, f)
+		kind := classifyError(err)
+		if kind == errKindNone || attempt >= policy.MaxRetries {
+			return reply, err
+		}
+		if kind == errKindConn && sent && !idempotent {
+			return reply, err
+		}
+
+		// master变成slave或连不上时重新获取master, 不用等sentinel推送+switch-master
+		if !toSlave && (kind == errKindReadOnly || kind == errKindConn) {
+			s.reResolveMaster(g)
+		}
+
+		s.options.logger.Debug("retry command", logger.F("master", g.name), logger.F("cmd", name),
+			logger.F("attempt", attempt+1), logger.Err(err))
+		if !waitRetry(ctx, swapped, policy.backoff(attempt)) {
+			return reply, err
+		}
+	}
+}
+
+// doOnce 借连接执行一次f, sent表示已借到连接, 命令可能已发出
+func (s *sentinelClient) doOnce(ctx context.Context, g *masterGroup, toSlave bool, f func(conn redis.Conn) (interface{}, error)) (reply interface{}, sent bool, err error) {
+	conn, err := s.routeConn(ctx, g, toSlave)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	reply, err = f(conn)
+	return reply, true, err
+}
+
+// routeConn toSlave为true时借slave连接, 否则借master连接, master下线时返回errMasterDown
+func (s *sentinelClient) routeConn(ctx context.Context, g *masterGroup, toSlave bool) (redis.Conn, error) {
+	if toSlave {
+		return s.GetSlaverClientContext(ctx, g.name)
+	}
+	// 写到即将被替换的master可能丢失, 等切换完成
+	if g.isMasterDown() {
+		return nil, errMasterDown
+	}
+	return s.GetMasterClientContext(ctx, g.name)
+}
+
+// waitRetry 等到master切换或退避时间到, ctx结束时返回false
+func waitRetry(ctx context.Context, swapped <-chan struct{}, backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-swapped:
+		return true
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// masterSwapped 当前master连接池切换时关闭的chan
+func (g *masterGroup) masterSwapped() <-chan struct{} {
+	g.master.poolMutex.RLock()
+	defer g.master.poolMutex.RUnlock()
+	return g.master.swapped
+}
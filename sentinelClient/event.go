@@ -0,0 +1,322 @@
+package sentinelClient
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// FailoverEvent 主从切换事件
+type FailoverEvent struct {
+	MasterName string    // master-name
+	OldAddr    string    // 切换前master地址
+	NewAddr    string    // 切换后master地址
+	Sentinel   string    // 上报切换的sentinel
+	Time       time.Time // 收到切换的时间
+	Epoch      int64     // 切换时的config-epoch, 未知为-1
+	Err        error     // 非空表示切换未通过quorum或ROLE校验, 连接池未切换
+}
+
+func (e FailoverEvent) String() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s(old) --> %s(refused), err:%v", e.MasterName, e.OldAddr, e.NewAddr, e.Err)
+	}
+	return fmt.Sprintf("%s: %s(old) --> %s(now)", e.MasterName, e.OldAddr, e.NewAddr)
+}
+
+// parseSwitchMaster 解析+switch-master消息: <master-name> <old-ip> <old-port> <new-ip> <new-port>
+func parseSwitchMaster(data string) (FailoverEvent, error) {
+	info := strings.Split(data, " ")
+	if len(info) != 5 {
+		return FailoverEvent{}, errEventFormat
+	}
+
+	return FailoverEvent{
+		MasterName: info[0],
+		OldAddr:    net.JoinHostPort(info[1], info[2]),
+		NewAddr:    net.JoinHostPort(info[3], info[4]),
+		Time:       time.Now(),
+		Epoch:      -1,
+	}, nil
+}
+
+// SentinelEvent sentinel发布的事件
+type SentinelEvent struct {
+	Type         string    // 事件类型, 即频道名, 如+sdown/-odown/+slave
+	InstanceType string    // 实例类型, master/slave/sentinel, 非实例事件为空
+	Name         string    // 实例名
+	Addr         string    // 实例地址
+	MasterName   string    // 实例所属的master-name
+	MasterAddr   string    // 实例所属的master地址
+	Data         string    // 原始消息
+	Time         time.Time // 收到事件的时间
+}
+
+// parseSentinelEvent 解析sentinel事件
+// 实例事件格式: <instance-type> <name> <ip> <port> @ <master-name> <master-ip> <master-port>
+// 实例是master时没有@之后的部分, +switch-master等事件格式不同单独处理
+func parseSentinelEvent(channel, data string) (SentinelEvent, error) {
+	event := SentinelEvent{Type: channel, Data: data, Time: time.Now()}
+
+	if channel == "+switch-master" {
+		failover, err := parseSwitchMaster(data)
+		if err != nil {
+			return event, err
+		}
+		event.InstanceType = "master"
+		event.Name = failover.MasterName
+		event.Addr = failover.NewAddr
+		event.MasterName = failover.MasterName
+		event.MasterAddr = failover.NewAddr
+		return event, nil
+	}
+
+	parts := strings.SplitN(data, " @ ", 2)
+	fields := strings.Fields(parts[0])
+	switch {
+	case len(fields) >= 4 && isInstanceType(fields[0]):
+	case len(parts) == 1:
+		// +new-epoch/+tilt等非实例事件
+		return event, nil
+	default:
+		return event, errEventFormat
+	}
+
+	event.InstanceType = fields[0]
+	event.Name = fields[1]
+	event.Addr = net.JoinHostPort(fields[2], fields[3])
+
+	if len(parts) == 1 {
+		event.MasterName = event.Name
+		event.MasterAddr = event.Addr
+		return event, nil
+	}
+
+	masterFields := strings.Fields(parts[1])
+	if len(masterFields) < 3 {
+		return event, errEventFormat
+	}
+	event.MasterName = masterFields[0]
+	event.MasterAddr = net.JoinHostPort(masterFields[1], masterFields[2])
+	return event, nil
+}
+
+func isInstanceType(s string) bool {
+	return s == "master" || s == "slave" || s == "sentinel"
+}
+
+// subscriber 事件订阅者, send不阻塞, chan满时返回false
+type subscriber struct {
+	send  func(event interface{}) bool
+	close func()
+}
+
+// eventBroker 事件分发给所有订阅者
+type eventBroker struct {
+	mutex  sync.Mutex
+	nextID int
+	subs   map[int]subscriber
+}
+
+// subscribe 添加订阅者, 返回取消订阅函数
+func (b *eventBroker) subscribe(sub subscriber) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subs == nil {
+		b.subs = make(map[int]subscriber)
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			if sub, ok := b.subs[id]; ok {
+				delete(b.subs, id)
+				sub.close()
+			}
+		})
+	}
+}
+
+// publish 分发事件, 订阅者chan满了则丢弃, 不阻塞事件处理, 返回丢弃的订阅者数
+func (b *eventBroker) publish(event interface{}) (dropped int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, sub := range b.subs {
+		if !sub.send(event) {
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// subscribeFailover 订阅主从切换事件
+func (b *eventBroker) subscribeFailover(size int) (<-chan FailoverEvent, func()) {
+	ch := make(chan FailoverEvent, size)
+	cancel := b.subscribe(subscriber{
+		send: func(event interface{}) bool {
+			e, ok := event.(FailoverEvent)
+			if !ok {
+				return true
+			}
+			select {
+			case ch <- e:
+				return true
+			default:
+				return false
+			}
+		},
+		close: func() { close(ch) },
+	})
+	return ch, cancel
+}
+
+// subscribeSentinelEvent 订阅sentinel事件
+func (b *eventBroker) subscribeSentinelEvent(size int) (<-chan SentinelEvent, func()) {
+	ch := make(chan SentinelEvent, size)
+	cancel := b.subscribe(subscriber{
+		send: func(event interface{}) bool {
+			e, ok := event.(SentinelEvent)
+			if !ok {
+				return true
+			}
+			select {
+			case ch <- e:
+				return true
+			default:
+				return false
+			}
+		},
+		close: func() { close(ch) },
+	})
+	return ch, cancel
+}
+
+// handleSentinelEvent 处理sentinel事件, 在主从切换完成前提前标记不健康的实例
+func (s *sentinelClient) handleSentinelEvent(channel, data string) {
+	event, err := parseSentinelEvent(channel, data)
+	if err != nil {
+		s.options.logger.Warn("sentinel event format err", logger.F("channel", channel), logger.F("data", data))
+		return
+	}
+
+	if event.Type == "+switch-master" {
+		s.switchMaster(data)
+	}
+
+	if g, err := s.getGroup(event.MasterName); err == nil {
+		switch event.Type {
+		case "+sdown", "+odown":
+			if event.InstanceType == "slave" {
+				if g.slaves.markDown(event.Name) {
+					s.options.logger.Info("slave down", logger.F("master", g.name), logger.F("slave", event.Name), logger.F("event", event.Type))
+				}
+			} else if event.InstanceType == "master" && event.Type == "+odown" {
+				// +sdown只是订阅的这个sentinel的主观判断, 多数sentinel确认下线(+odown)才停止写master
+				g.setMasterDown(true)
+				s.options.logger.Warn("master down", logger.F("master", g.name), logger.F("addr", event.Addr), logger.F("event", event.Type))
+			}
+		case "-sdown", "-odown", "+slave", "+reboot":
+			if event.InstanceType == "slave" {
+				s.goroutine(func() { s.refreshSlaves(g) })
+			} else if event.InstanceType == "master" && event.Type == "-odown" {
+				g.setMasterDown(false)
+			}
+		case "+try-failover":
+			g.setMasterDown(true)
+			s.options.logger.Warn("try failover", logger.F("master", g.name), logger.F("addr", event.Addr))
+		case "+sentinel":
+			for _, host := range s.addSentinelHosts(event.Addr) {
+				s.options.logger.Info("sentinel discovered", logger.F("master", g.name), logger.F("sentinel", host))
+			}
+		default:
+			// 切换中止, 继续使用原master
+			if strings.HasPrefix(event.Type, "-failover-abort-") {
+				g.setMasterDown(false)
+				s.options.logger.Warn("failover abort", logger.F("master", g.name), logger.F("event", event.Type))
+			}
+		}
+	}
+
+	s.publish(event)
+}
+
+// refreshSlaves 通过当前订阅的sentinel刷新slave列表
+func (s *sentinelClient) refreshSlaves(g *masterGroup) {
+	if err := s.initRedisPool(g, s.getSentinelHost(), slave, false); err != nil {
+		s.options.logger.Warn("refresh slave err", logger.F("master", g.name), logger.Err(err))
+		s.setLastError(err)
+	}
+}
+
+// getSentinelMaster 从sentinel获取master当前状态, 即SENTINEL master <name>
+func (s *sentinelClient) getSentinelMaster(sentinelHost, masterName string) (map[string]string, error) {
+	conn, err := s.dialSentinel(sentinelHost)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return redis.StringMap(conn.Do("SENTINEL", "master", masterName))
+}
+
+// getConfigEpoch 从sentinel获取master当前的config-epoch
+func (s *sentinelClient) getConfigEpoch(sentinelHost, masterName string) (int64, error) {
+	m, err := s.getSentinelMaster(sentinelHost, masterName)
+	if err != nil {
+		return -1, err
+	}
+
+	return parseInt64(m["config-epoch"], -1), nil
+}
+
+// ConfigEpoch 从当前sentinel获取master的config-epoch, 每次主从切换递增
+func (s *sentinelClient) ConfigEpoch(masterName string) (int64, error) {
+	if s.isClosed() {
+		return -1, errClosed
+	}
+
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return -1, err
+	}
+
+	epoch, err := s.getConfigEpoch(s.getSentinelHost(), g.name)
+	if err == nil && epoch < 0 {
+		err = errGetInfoBySentinel
+	}
+	return epoch, err
+}
+
+// checkMasterDown 按sentinel当前的master标记(o_down/failover_in_progress)校正下线标记
+// 订阅断开或换了sentinel时可能错过-odown/-failover-abort-*, 避免一直拒绝写健康的master
+func (s *sentinelClient) checkMasterDown(g *masterGroup, sentinelHost string) {
+	m, err := s.getSentinelMaster(sentinelHost, g.name)
+	if err != nil {
+		s.options.logger.Warn("check master down err", logger.F("master", g.name), logger.F("sentinel", sentinelHost), logger.Err(err))
+		return
+	}
+
+	var down bool
+	for _, flag := range strings.Split(m["flags"], ",") {
+		if flag == "o_down" || flag == "failover_in_progress" {
+			down = true
+		}
+	}
+	if down != g.isMasterDown() {
+		g.setMasterDown(down)
+		s.options.logger.Info("master down corrected", logger.F("master", g.name), logger.F("down", down), logger.F("flags", m["flags"]))
+	}
+}
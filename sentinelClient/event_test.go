@@ -0,0 +1,144 @@
+package sentinelClient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseSwitchMaster(t *testing.T) {
+	event, err := parseSwitchMaster("mymaster 10.0.0.1 6379 10.0.0.2 6380")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.MasterName != "mymaster" || event.OldAddr != "10.0.0.1:6379" || event.NewAddr != "10.0.0.2:6380" {
+		t.Fatalf("event = %+v", event)
+	}
+
+	if _, err = parseSwitchMaster("mymaster 10.0.0.1 6379"); err != errEventFormat {
+		t.Fatalf("err = %v, want errEventFormat", err)
+	}
+}
+
+func TestEventBroker_SubscribeFailover(t *testing.T) {
+	var b eventBroker
+	ch1, cancel1 := b.subscribeFailover(1)
+	ch2, cancel2 := b.subscribeFailover(1)
+	defer cancel2()
+
+	b.publish(FailoverEvent{MasterName: "m1"})
+	if e := <-ch1; e.MasterName != "m1" {
+		t.Fatalf("ch1 got %+v", e)
+	}
+	if e := <-ch2; e.MasterName != "m1" {
+		t.Fatalf("ch2 got %+v", e)
+	}
+
+	cancel1()
+	cancel1()
+	if _, ok := <-ch1; ok {
+		t.Fatal("ch1 should be closed after cancel")
+	}
+
+	// chan满时丢弃, 不阻塞
+	b.publish(FailoverEvent{MasterName: "m2"})
+	b.publish(FailoverEvent{MasterName: "m3"})
+	if e := <-ch2; e.MasterName != "m2" {
+		t.Fatalf("ch2 got %+v", e)
+	}
+}
+
+func TestParseSentinelEvent(t *testing.T) {
+	tests := []struct {
+		channel string
+		data    string
+		want    SentinelEvent
+	}{
+		{
+			"+sdown", "slave 10.0.0.2:6379 10.0.0.2 6379 @ mymaster 10.0.0.1 6379",
+			SentinelEvent{InstanceType: "slave", Name: "10.0.0.2:6379", Addr: "10.0.0.2:6379", MasterName: "mymaster", MasterAddr: "10.0.0.1:6379"},
+		},
+		{
+			"+odown", "master mymaster 10.0.0.1 6379 #quorum 2/2",
+			SentinelEvent{InstanceType: "master", Name: "mymaster", Addr: "10.0.0.1:6379", MasterName: "mymaster", MasterAddr: "10.0.0.1:6379"},
+		},
+		{
+			"+switch-master", "mymaster 10.0.0.1 6379 10.0.0.2 6379",
+			SentinelEvent{InstanceType: "master", Name: "mymaster", Addr: "10.0.0.2:6379", MasterName: "mymaster", MasterAddr: "10.0.0.2:6379"},
+		},
+		{
+			"+new-epoch", "12",
+			SentinelEvent{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			got, err := parseSentinelEvent(tt.channel, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Type, tt.want.Data, tt.want.Time = tt.channel, tt.data, got.Time
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentinelClient_MasterDownFlag(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+	r := newFakeServer(t, fakeRedis("slave"))
+	defer r.close()
+
+	var flags atomic.Value
+	flags.Store("master")
+	sentinel := newFakeServer(t, func(args []string) interface{} {
+		if strings.EqualFold(args[0], "SENTINEL") && len(args) == 3 && strings.EqualFold(args[1], "master") {
+			return []string{"name", "mymaster", "flags", flags.Load().(string), "config-epoch", "3"}
+		}
+		return fakeSentinel("mymaster", m.addr())(args)
+	})
+	defer sentinel.close()
+
+	s := newTestClient("mymaster", m.addr(), SentinelHosts([]string{sentinel.addr()}))
+	defer s.Close(context.Background())
+	g := s.groups["mymaster"]
+
+	// 一个sentinel的主观下线不停止写master
+	s.handleSentinelEvent("+sdown", "master mymaster 127.0.0.1 6379")
+	if g.isMasterDown() {
+		t.Fatal("master down on +sdown")
+	}
+	s.handleSentinelEvent("+odown", "master mymaster 127.0.0.1 6379 #quorum 2/2")
+	s.handleSentinelEvent("-sdown", "master mymaster 127.0.0.1 6379")
+	if !g.isMasterDown() {
+		t.Fatal("master down cleared by -sdown")
+	}
+	s.handleSentinelEvent("-odown", "master mymaster 127.0.0.1 6379")
+	if g.isMasterDown() {
+		t.Fatal("master down not cleared by -odown")
+	}
+
+	// 切换被拒绝时不清除, 写不能回到已降级的master
+	rHost, rPort, _ := net.SplitHostPort(r.addr())
+	mHost, mPort, _ := net.SplitHostPort(m.addr())
+	s.handleSentinelEvent("+try-failover", "master mymaster 127.0.0.1 6379")
+	s.handleSentinelEvent("+switch-master", strings.Join([]string{"mymaster", mHost, mPort, rHost, rPort}, " "))
+	if !g.isMasterDown() || g.getMasterHost() != m.addr() {
+		t.Fatalf("down = %v, master = %s after refused switch", g.isMasterDown(), g.getMasterHost())
+	}
+
+	// 错过事件时按sentinel的标记校正
+	s.checkMasterDown(g, sentinel.addr())
+	if g.isMasterDown() {
+		t.Fatal("master down not cleared by sentinel flags")
+	}
+	flags.Store("master,o_down")
+	s.checkMasterDown(g, sentinel.addr())
+	if !g.isMasterDown() {
+		t.Fatal("master down not set by sentinel o_down flag")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"gzoo/common/sentinelClient"
 	"log"
@@ -10,9 +11,11 @@ import (
 	"github.com/garyburd/redigo/redis"
 )
 
+const masterName = "test-sentinel"
+
 // setAndGet 测试正常读写
 func setAndGet(sc sentinelClient.SentinelClient) {
-	conn := sc.GetMasterClient()
+	conn := sc.GetMasterClient(masterName)
 	defer conn.Close()
 
 	if _, err := redis.Int(conn.Do("SET", "name", "aaa")); err != nil {
@@ -34,7 +37,7 @@ func autoSwitchMaster(sc sentinelClient.SentinelClient) {
 	go func() {
 		defer wg1.Done()
 
-		conn := sc.GetMasterClient()
+		conn := sc.GetMasterClient(masterName)
 		defer conn.Close()
 
 		if _, err := redis.Int(conn.Do("SET", "name", "aaa")); err != nil {
@@ -59,7 +62,7 @@ func autoSwitchMaster(sc sentinelClient.SentinelClient) {
 	go func() {
 		defer wg2.Done()
 
-		conn := sc.GetMasterClient()
+		conn := sc.GetMasterClient(masterName)
 		defer conn.Close()
 
 		if _, err := redis.Int(conn.Do("SET", "name", "bbb")); err != nil {
@@ -75,15 +78,15 @@ func autoSwitchMaster(sc sentinelClient.SentinelClient) {
 	wg2.Wait()
 }
 
-func recvSwitchMasterCallback(text string) {
-	fmt.Println(text)
+func recvSwitchMasterCallback(event sentinelClient.FailoverEvent) {
+	fmt.Println(event)
 }
 
 func main() {
 	sc := sentinelClient.New()
 	if err := sc.Init(
 		sentinelClient.SentinelHosts([]string{"127.0.0.1:11001", "127.0.0.1:11002", "127.0.0.1:11003"}),
-		sentinelClient.MasterName("test-sentinel"),
+		sentinelClient.MasterName(masterName),
 		sentinelClient.MaxIdle(16),
 		sentinelClient.MaxActive(64),
 		sentinelClient.DialConnTimeout(time.Second*5),
@@ -94,7 +97,7 @@ func main() {
 	); err != nil {
 		log.Fatal(fmt.Sprintf("init sentinel err:%v", err))
 	}
-	defer sc.Close()
+	defer sc.Close(context.Background())
 
 	setAndGet(sc)
 	autoSwitchMaster(sc)
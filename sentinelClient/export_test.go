@@ -0,0 +1,74 @@
+package sentinelClient
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// LuaTestEnv 给外部测试包(如lock)用的测试环境: 执行lua脚本的fake master和返回config-epoch的fake sentinel
+type LuaTestEnv struct {
+	Client   SentinelClient
+	t        *testing.T
+	s        *sentinelClient
+	sentinel *fakeServer
+	mutex    sync.Mutex
+	epoch    int64
+	master   *fakeLuaRedis
+	servers  []*fakeServer
+}
+
+// NewLuaTestEnv 创建测试环境, 用完需要Close
+func NewLuaTestEnv(t *testing.T, masterName string, epoch int64) *LuaTestEnv {
+	e := &LuaTestEnv{t: t, epoch: epoch, master: newFakeLuaRedis()}
+	m := newFakeServer(t, e.master.handle)
+	e.servers = append(e.servers, m)
+
+	e.sentinel = newFakeServer(t, func(args []string) interface{} {
+		if strings.EqualFold(args[0], "SENTINEL") && len(args) == 3 && strings.EqualFold(args[1], "master") && args[2] == masterName {
+			e.mutex.Lock()
+			defer e.mutex.Unlock()
+			return []string{"name", masterName, "flags", "master", "config-epoch", strconv.FormatInt(e.epoch, 10)}
+		}
+		return fakeSentinel(masterName, m.addr())(args)
+	})
+
+	e.s = newTestClient(masterName, m.addr())
+	e.s.sentinelHost = e.sentinel.addr()
+	e.Client = e.s
+	return e
+}
+
+// Get 读取当前master上的key
+func (e *LuaTestEnv) Get(key string) (string, bool) {
+	e.mutex.Lock()
+	master := e.master
+	e.mutex.Unlock()
+	return master.get(key)
+}
+
+// Failover 切换到一个空的新master并递增config-epoch, 模拟新master丢失所有未同步的写入
+func (e *LuaTestEnv) Failover() {
+	master := newFakeLuaRedis()
+	m := newFakeServer(e.t, master.handle)
+
+	e.mutex.Lock()
+	e.epoch++
+	e.master = master
+	e.servers = append(e.servers, m)
+	e.mutex.Unlock()
+
+	for _, g := range e.s.groups {
+		e.s.swapMasterPool(g, m.addr())
+	}
+}
+
+func (e *LuaTestEnv) Close() {
+	e.s.Close(context.Background())
+	e.sentinel.close()
+	for _, m := range e.servers {
+		m.close()
+	}
+}
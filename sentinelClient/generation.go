@@ -0,0 +1,153 @@
+package sentinelClient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// DrainResult 主从切换后旧master连接池的排空结果
+type DrainResult struct {
+	MasterName string        // master-name
+	Addr       string        // 旧master地址
+	Generation uint64        // 旧连接池的代数
+	Drained    int           // 超时前正常归还的连接数
+	Killed     int           // 超时后强制关闭的连接数
+	Duration   time.Duration // 排空耗时
+}
+
+// poolGeneration 一代master连接池, 切换master时旧的一代停止借出, 借出的连接用完归还后关闭
+type poolGeneration struct {
+	id    uint64                       // 代数
+	host  string                       // master地址
+	pool  *redis.Pool                  // 连接池
+	mutex sync.Mutex                   // 锁
+	conns map[*generationConn]struct{} // 该代连接池建立且未关闭的连接
+}
+
+func newPoolGeneration(id uint64, host string, pool *redis.Pool) *poolGeneration {
+	gen := &poolGeneration{
+		id:    id,
+		host:  host,
+		pool:  pool,
+		conns: make(map[*generationConn]struct{}),
+	}
+
+	dial := pool.Dial
+	pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		if err != nil {
+			return nil, err
+		}
+
+		gc := &generationConn{Conn: c, gen: gen}
+		gen.mutex.Lock()
+		gen.conns[gc] = struct{}{}
+		gen.mutex.Unlock()
+		return gc, nil
+	}
+
+	return gen
+}
+
+// retire 停止借出并关闭空闲连接, 等待借出的连接归还, 超时或stop关闭后强制关闭剩余连接
+func (gen *poolGeneration) retire(timeout time.Duration, stop <-chan struct{}) DrainResult {
+	start := time.Now()
+	borrowedN := borrowed(gen.pool)
+
+	// 关闭后Get返回错误, 借出的连接不受影响, 归还时关闭
+	gen.pool.Close()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+wait:
+	for gen.pool.ActiveCount() > 0 {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			break wait
+		case <-stop:
+			break wait
+		}
+	}
+
+	killed := gen.kill()
+	return DrainResult{
+		Addr:       gen.host,
+		Generation: gen.id,
+		Drained:    borrowedN - killed,
+		Killed:     killed,
+		Duration:   time.Since(start),
+	}
+}
+
+// kill 强制关闭该代所有未关闭的连接, 正在执行的命令会返回错误
+func (gen *poolGeneration) kill() int {
+	gen.mutex.Lock()
+	conns := gen.conns
+	gen.conns = make(map[*generationConn]struct{})
+	gen.mutex.Unlock()
+
+	for c := range conns {
+		c.Conn.Close()
+	}
+	return len(conns)
+}
+
+// currentPoolGen 当前一代master连接池
+func (g *masterGroup) currentPoolGen() *poolGeneration {
+	g.master.poolMutex.RLock()
+	defer g.master.poolMutex.RUnlock()
+	return g.master.poolGen
+}
+
+// isPoolClosedError 是否从已关闭的连接池借连接, 等待中的借用在连接池关闭时也返回该错误
+func isPoolClosedError(err error) bool {
+	return err != nil && err.Error() == "redigo: get on closed pool"
+}
+
+// generationConn 连接关闭时从所属代中移除
+type generationConn struct {
+	redis.Conn
+	gen *poolGeneration
+}
+
+func (c *generationConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+}
+
+func (c *generationConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *generationConn) Close() error {
+	c.gen.mutex.Lock()
+	delete(c.gen.conns, c)
+	c.gen.mutex.Unlock()
+	return c.Conn.Close()
+}
+
+// retireMasterPool 后台排空旧master连接池, Close时不再等待, 直接关闭剩余连接
+func (s *sentinelClient) retireMasterPool(g *masterGroup, gen *poolGeneration) {
+	started := s.goroutine(func() {
+		result := gen.retire(s.options.drainTimeout, s.stop)
+		result.MasterName = g.name
+
+		s.options.logger.Info("master pool drained", logger.F("master", g.name), logger.F("addr", result.Addr),
+			logger.F("generation", result.Generation), logger.F("drained", result.Drained),
+			logger.F("killed", result.Killed), logger.F("duration", result.Duration))
+		if s.options.drainHook != nil {
+			s.options.drainHook(result)
+		}
+	})
+
+	// 已关闭时不再等待, 直接关闭
+	if !started {
+		gen.pool.Close()
+	}
+}
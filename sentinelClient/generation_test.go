@@ -0,0 +1,161 @@
+package sentinelClient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestSentinelClient_SwapMasterPoolDrain(t *testing.T) {
+	m1 := newFakeServer(t, fakeRedis("master"))
+	m2 := newFakeServer(t, fakeRedis("master"))
+	defer m1.close()
+	defer m2.close()
+
+	results := make(chan DrainResult, 1)
+	s := newTestClient("mymaster", m1.addr(), DrainTimeout(time.Second), DrainCallback(func(r DrainResult) {
+		results <- r
+	}))
+	g := s.groups["mymaster"]
+
+	old, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.swapMasterPool(g, m2.addr())
+
+	// 新借出的连接使用新master, 旧连接仍可继续使用
+	conn, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if g.getMasterHost() != m2.addr() {
+		t.Fatalf("master host = %s, want %s", g.getMasterHost(), m2.addr())
+	}
+	if _, err = redis.String(old.Do("PING")); err != nil {
+		t.Fatalf("old conn err = %v", err)
+	}
+	old.Close()
+
+	select {
+	case r := <-results:
+		if r.Drained != 1 || r.Killed != 0 || r.Generation != 1 || r.Addr != m1.addr() {
+			t.Fatalf("drain result = %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain result timeout")
+	}
+}
+
+func TestPoolGeneration_RetireKill(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	gen := newPoolGeneration(1, m.addr(), s.createRedisPool(m.addr()))
+
+	conn := gen.pool.Get()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gen.retire(20*time.Millisecond, nil)
+	if r.Drained != 0 || r.Killed != 1 {
+		t.Fatalf("drain result = %+v", r)
+	}
+	if _, err := conn.Do("PING"); err == nil {
+		t.Fatal("killed conn should return error")
+	}
+	conn.Close()
+}
+
+func TestSentinelClient_SwapMasterPoolWaiter(t *testing.T) {
+	m1 := newFakeServer(t, fakeRedis("master"))
+	m2 := newFakeServer(t, fakeRedis("master"))
+	defer m1.close()
+	defer m2.close()
+
+	s := newTestClient("mymaster", m1.addr(), MaxActive(1))
+	defer s.Close(context.Background())
+	g := s.groups["mymaster"]
+
+	// 连接池满, 等待中的借用在切换后到新master借
+	held, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := s.Do(ForceMaster(context.Background()), "mymaster", "SET", "k", "v")
+		done <- result{reply, err}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	s.swapMasterPool(g, m2.addr())
+
+	select {
+	case r := <-done:
+		if r.err != nil || r.reply != "OK" {
+			t.Fatalf("reply = %v, err = %v", r.reply, r.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not moved to new master pool")
+	}
+}
+
+func TestSentinelClient_CloseDuringDrain(t *testing.T) {
+	m1 := newFakeServer(t, fakeRedis("master"))
+	m2 := newFakeServer(t, fakeRedis("master"))
+	defer m1.close()
+	defer m2.close()
+
+	s := newTestClient("mymaster", m1.addr(), DrainTimeout(10*time.Second))
+	s.stop = make(chan struct{})
+
+	old, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	s.swapMasterPool(s.groups["mymaster"], m2.addr())
+
+	// 切换后马上Close, 不等旧连接池排空, 剩余连接直接关闭
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = s.Close(ctx); err != nil {
+		t.Fatalf("close err = %v", err)
+	}
+	if _, err = old.Do("PING"); err == nil {
+		t.Fatal("old conn should be killed after Close")
+	}
+}
+
+func TestGenerationConn_WithTimeout(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+
+	// 连接池的连接包装了generationConn, 要能透传DoWithTimeout/ReceiveWithTimeout
+	conn := s.groups["mymaster"].currentPoolGen().pool.Get()
+	defer conn.Close()
+	if reply, err := redis.DoWithTimeout(conn, time.Second, "PING"); err != nil || reply != "PONG" {
+		t.Fatalf("DoWithTimeout reply = %v, err = %v", reply, err)
+	}
+	conn.Send("PING")
+	conn.Flush()
+	if reply, err := redis.ReceiveWithTimeout(conn, time.Second); err != nil || reply != "PONG" {
+		t.Fatalf("ReceiveWithTimeout reply = %v, err = %v", reply, err)
+	}
+}
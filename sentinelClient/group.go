@@ -0,0 +1,51 @@
+package sentinelClient
+
+import "sync/atomic"
+
+// masterGroup sentinel监控的一组主从
+type masterGroup struct {
+	name       string        // master-name
+	master     redisInfo     // redis主
+	slaves     replicaSet    // 所有可用redis从
+	probes     probeConns    // 探测slave的长连接
+	masterDown int32         // sentinel报告master下线或正在切换
+	resolving  int32         // 正在重新获取master
+	failover   failoverStats // 切换统计
+}
+
+func newMasterGroup(name string) *masterGroup {
+	return &masterGroup{name: name}
+}
+
+// getGroup 根据master-name获取主从组
+func (s *sentinelClient) getGroup(name string) (*masterGroup, error) {
+	g, ok := s.groups[name]
+	if !ok {
+		return nil, errUnknownMasterName
+	}
+	return g, nil
+}
+
+func (g *masterGroup) setMasterHost(host string) {
+	g.master.mutex.Lock()
+	defer g.master.mutex.Unlock()
+	g.master.host = host
+}
+
+func (g *masterGroup) getMasterHost() string {
+	g.master.mutex.RLock()
+	defer g.master.mutex.RUnlock()
+	return g.master.host
+}
+
+func (g *masterGroup) setMasterDown(down bool) {
+	var v int32
+	if down {
+		v = 1
+	}
+	atomic.StoreInt32(&g.masterDown, v)
+}
+
+func (g *masterGroup) isMasterDown() bool {
+	return atomic.LoadInt32(&g.masterDown) == 1
+}
@@ -0,0 +1,270 @@
+package sentinelClient
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// healthCheck 单项检查结果
+type healthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func newHealthCheck(err error) healthCheck {
+	if err != nil {
+		return healthCheck{Error: err.Error()}
+	}
+	return healthCheck{OK: true}
+}
+
+// groupHealth 主从组检查结果
+type groupHealth struct {
+	Master  healthCheck `json:"master"`
+	Replica healthCheck `json:"replica"`
+}
+
+// readiness 就绪检查结果, 订阅正常且所有主从组master可达时就绪, 配置ReadyRequireReplica时还要求有可用slave
+type readiness struct {
+	Ready  bool                   `json:"ready"`
+	PubSub healthCheck            `json:"pubsub"`
+	Groups map[string]groupHealth `json:"groups"`
+}
+
+// topology 主从拓扑
+type topology struct {
+	Sentinel  string          `json:"sentinel"`
+	Sentinels []string        `json:"sentinels"`
+	PubSub    string          `json:"pubsub"`
+	Groups    []groupTopology `json:"groups"`
+}
+
+type groupTopology struct {
+	MasterName   string            `json:"master_name"`
+	Master       string            `json:"master"`
+	MasterDown   bool              `json:"master_down"`
+	Generation   uint64            `json:"generation"`
+	Replicas     []replicaTopology `json:"replicas"`
+	LastFailover *failoverTopology `json:"last_failover,omitempty"`
+	Error        string            `json:"error,omitempty"` // 从sentinel获取slave失败, replicas只有本地在用的slave
+}
+
+type replicaTopology struct {
+	Addr       string   `json:"addr"`
+	Flags      []string `json:"flags,omitempty"`
+	LinkStatus string   `json:"link_status,omitempty"`
+	Priority   int64    `json:"priority"`
+	InUse      bool     `json:"in_use"` // 是否在本地slave连接池中
+	Down       bool     `json:"down"`
+	LagOffset  int64    `json:"lag_offset"`
+	LagSeconds int64    `json:"lag_seconds"`
+	LatencyMs  float64  `json:"latency_ms"`
+}
+
+type failoverTopology struct {
+	OldAddr  string    `json:"old_addr"`
+	NewAddr  string    `json:"new_addr"`
+	Sentinel string    `json:"sentinel,omitempty"`
+	Time     time.Time `json:"time"`
+	Epoch    int64     `json:"epoch"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// HealthHandler 就绪检查和拓扑查询, 路径以/topology结尾时返回拓扑, 其他路径返回就绪检查, 未就绪时状态码503
+func (s *sentinelClient) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/topology") {
+			writeJSON(w, http.StatusOK, s.topology())
+			return
+		}
+
+		ready := s.readiness()
+		status := http.StatusOK
+		if !ready.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, ready)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// readiness 检查订阅连接, 并发ping每个主从组的master, 检查是否有可用slave
+// sentinel报告master下线期间不ping, 直接按未就绪报告
+// 只有master的部署没有slave时读master, 默认slave状态只报告不影响就绪
+func (s *sentinelClient) readiness() readiness {
+	var pubSubErr error
+	switch {
+	case s.isClosed():
+		pubSubErr = errClosed
+	case s.getPubSubStatus() != connectNormal:
+		pubSubErr = errPubSubDown
+	}
+
+	ready := readiness{
+		PubSub: newHealthCheck(pubSubErr),
+		Groups: make(map[string]groupHealth, len(s.groups)),
+	}
+	ready.Ready = ready.PubSub.OK
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for name, g := range s.groups {
+		wg.Add(1)
+		go func(name string, g *masterGroup) {
+			defer wg.Done()
+
+			masterErr := errMasterDown
+			if !g.isMasterDown() {
+				masterErr = s.pingMaster(g)
+			}
+			gh := groupHealth{
+				Master:  newHealthCheck(masterErr),
+				Replica: newHealthCheck(s.checkReplica(g)),
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			ready.Ready = ready.Ready && gh.Master.OK && (gh.Replica.OK || !s.options.readyRequireReplica)
+			ready.Groups[name] = gh
+		}(name, g)
+	}
+	wg.Wait()
+	return ready
+}
+
+// pingMaster 单独建连ping一次master, 不占用连接池, 建连和读写分别受dialConnTimeout/dialTimeout限制
+func (s *sentinelClient) pingMaster(g *masterGroup) error {
+	if s.isClosed() {
+		return errClosed
+	}
+
+	conn, err := s.dialRedis(
+		g.getMasterHost(),
+		redis.DialConnectTimeout(s.options.dialConnTimeout),
+		redis.DialReadTimeout(s.options.dialTimeout),
+		redis.DialWriteTimeout(s.options.dialTimeout),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("PING")
+	return err
+}
+
+// checkReplica 至少有一个未下线且复制延迟未超限的slave
+func (s *sentinelClient) checkReplica(g *masterGroup) error {
+	limit := s.lagLimit()
+	for _, r := range g.slaves.stats() {
+		if !r.Down && !limit.exceeded(r.ReplicaState) {
+			return nil
+		}
+	}
+	return errNoSlave
+}
+
+// topology 当前主从拓扑, slave的标记和复制状态从sentinel实时获取
+func (s *sentinelClient) topology() topology {
+	stats := s.Stats()
+	topo := topology{
+		Sentinel:  stats.Sentinel,
+		Sentinels: stats.Sentinels,
+		PubSub:    stats.PubSubStatus,
+		Groups:    make([]groupTopology, 0, len(stats.Groups)),
+	}
+
+	sentinelHost := s.getSentinelHost()
+	for name, gs := range stats.Groups {
+		gt := groupTopology{
+			MasterName: name,
+			Master:     gs.Master.Host,
+			MasterDown: gs.MasterDown,
+			Generation: gs.Generation,
+		}
+		if e := gs.LastFailover; e != nil {
+			gt.LastFailover = &failoverTopology{
+				OldAddr:  e.OldAddr,
+				NewAddr:  e.NewAddr,
+				Sentinel: e.Sentinel,
+				Time:     e.Time,
+				Epoch:    e.Epoch,
+			}
+			if e.Err != nil {
+				gt.LastFailover.Error = e.Err.Error()
+			}
+		}
+
+		var infos []ReplicaInfo
+		if g, err := s.getGroup(name); err == nil {
+			if infos, err = s.getSlaves(g, sentinelHost); err != nil {
+				gt.Error = err.Error()
+			}
+		}
+		gt.Replicas = mergeReplicaTopology(infos, gs.Replicas)
+		topo.Groups = append(topo.Groups, gt)
+	}
+
+	sort.Slice(topo.Groups, func(i, j int) bool { return topo.Groups[i].MasterName < topo.Groups[j].MasterName })
+	return topo
+}
+
+// mergeReplicaTopology 合并sentinel报告的slave和本地在用的slave, 按地址排序
+func mergeReplicaTopology(infos []ReplicaInfo, replicas []ReplicaStats) []replicaTopology {
+	inUse := make(map[string]ReplicaStats, len(replicas))
+	for _, r := range replicas {
+		inUse[r.Host] = r
+	}
+
+	topo := make([]replicaTopology, 0, len(infos))
+	seen := make(map[string]struct{}, len(infos))
+	for _, info := range infos {
+		rt := replicaTopology{
+			Addr:       info.Name,
+			Flags:      info.Flags,
+			LinkStatus: info.MasterLinkStatus,
+			Priority:   info.SlavePriority,
+			LagOffset:  -1,
+			LagSeconds: info.MasterLastIOSeconds,
+		}
+		if r, ok := inUse[info.Name]; ok {
+			rt.setStats(r)
+		}
+		seen[info.Name] = struct{}{}
+		topo = append(topo, rt)
+	}
+
+	// sentinel获取失败或还没刷新时, 补上本地在用的slave
+	for _, r := range replicas {
+		if _, ok := seen[r.Host]; ok {
+			continue
+		}
+		rt := replicaTopology{Addr: r.Host, Priority: -1}
+		rt.setStats(r)
+		topo = append(topo, rt)
+	}
+
+	sort.Slice(topo, func(i, j int) bool { return topo[i].Addr < topo[j].Addr })
+	return topo
+}
+
+func (rt *replicaTopology) setStats(r ReplicaStats) {
+	rt.InUse = true
+	rt.Down = r.Down
+	rt.LagOffset = r.LagOffset
+	if r.LagSeconds >= 0 {
+		rt.LagSeconds = r.LagSeconds
+	}
+	rt.LatencyMs = float64(r.Latency) / float64(time.Millisecond)
+}
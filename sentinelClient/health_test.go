@@ -0,0 +1,154 @@
+package sentinelClient
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSentinelClient_HealthHandler(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+	r := newFakeServer(t, fakeRedis("slave"))
+	defer r.close()
+
+	slaveHost, slavePort, _ := net.SplitHostPort(r.addr())
+	sentinel := newFakeServer(t, func(args []string) interface{} {
+		if strings.EqualFold(args[0], "SENTINEL") && len(args) == 3 && strings.EqualFold(args[1], "slaves") {
+			return []interface{}{
+				[]string{"name", r.addr(), "ip", slaveHost, "port", slavePort, "flags", "slave", "master-link-status", "ok", "slave-priority", "100"},
+				[]string{"name", "10.0.0.9:6379", "ip", "10.0.0.9", "port", "6379", "flags", "slave,s_down", "master-link-status", "err", "slave-priority", "100"},
+			}
+		}
+		return fakeSentinel("mymaster", m.addr())(args)
+	})
+	defer sentinel.close()
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+	s.sentinelHost = sentinel.addr()
+	h := s.HealthHandler()
+
+	// 没有slave时只报告, 仍然就绪
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/health/ready", nil))
+	var ready readiness
+	if err := json.NewDecoder(rec.Body).Decode(&ready); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !ready.Ready || !ready.PubSub.OK ||
+		!ready.Groups["mymaster"].Master.OK || ready.Groups["mymaster"].Replica.OK {
+		t.Fatalf("code = %d, readiness = %+v, want master ok and no replica", rec.Code, ready)
+	}
+
+	// 要求有可用slave时未就绪
+	s.options.readyRequireReplica = true
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/health/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("code = %d, want 503 without replica", rec.Code)
+	}
+
+	g := s.groups["mymaster"]
+	g.slaves.update(map[string]replicaProbe{r.addr(): {lagOffset: 3, lagSeconds: 1}}, s.createRedisPool)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/health/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	// sentinel报告master下线期间未就绪
+	g.setMasterDown(true)
+	if ready := s.readiness(); ready.Ready || ready.Groups["mymaster"].Master.Error != errMasterDown.Error() {
+		t.Fatalf("readiness = %+v, want master down", ready)
+	}
+	g.setMasterDown(false)
+
+	// 订阅断开时未就绪
+	s.setPubSubStatus(connectError)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/health/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("code = %d, want 503", rec.Code)
+	}
+
+	s.notifyFailover(FailoverEvent{MasterName: "mymaster", OldAddr: "10.0.0.1:6379", NewAddr: m.addr(), Epoch: 5})
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/health/topology", nil))
+	var topo topology
+	if err := json.NewDecoder(rec.Body).Decode(&topo); err != nil {
+		t.Fatal(err)
+	}
+	if topo.Sentinel != sentinel.addr() || topo.PubSub != "error" || len(topo.Groups) != 1 {
+		t.Fatalf("topology = %+v", topo)
+	}
+	gt := topo.Groups[0]
+	if gt.Master != m.addr() || gt.LastFailover == nil || gt.LastFailover.Epoch != 5 || gt.Error != "" {
+		t.Fatalf("group = %+v", gt)
+	}
+	if len(gt.Replicas) != 2 {
+		t.Fatalf("replicas = %+v, want 2", gt.Replicas)
+	}
+	for _, rt := range gt.Replicas {
+		switch rt.Addr {
+		case r.addr():
+			if !rt.InUse || rt.LagOffset != 3 || rt.LinkStatus != "ok" {
+				t.Fatalf("replica = %+v", rt)
+			}
+		case "10.0.0.9:6379":
+			if rt.InUse || len(rt.Flags) != 2 || rt.Flags[1] != "s_down" {
+				t.Fatalf("replica = %+v", rt)
+			}
+		default:
+			t.Fatalf("unexpected replica %+v", rt)
+		}
+	}
+}
+
+func TestSentinelClient_HealthHandlerHung(t *testing.T) {
+	hang := make(chan struct{})
+	h := newFakeServer(t, func(args []string) interface{} {
+		<-hang
+		return errCloseConn
+	})
+	defer h.close()
+	defer close(hang)
+
+	// master和sentinel都不回复时按读超时返回
+	s := newTestClient("mymaster", h.addr(), DialTimeout(50*time.Millisecond))
+	defer s.Close(context.Background())
+	s.sentinelHost = h.addr()
+
+	// 多个主从组并发ping, 总耗时不随组数增加
+	names := []string{"mymaster", "a", "b", "c"}
+	for _, name := range names[1:] {
+		g := newMasterGroup(name)
+		s.groups[name] = g
+		s.swapMasterPool(g, h.addr())
+	}
+	start := time.Now()
+	ready := s.readiness()
+	if d := time.Since(start); d >= 3*50*time.Millisecond {
+		t.Fatalf("readiness took %v, want groups pinged in parallel", d)
+	}
+	for _, name := range names {
+		if ready.Ready || ready.Groups[name].Master.OK {
+			t.Fatalf("readiness = %+v, want %s master unreachable", ready, name)
+		}
+	}
+
+	start = time.Now()
+	if topo := s.topology(); len(topo.Groups) != len(names) || topo.Groups[0].Error == "" {
+		t.Fatalf("topology = %+v, want sentinel error", topo)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Fatalf("health took %v, want bounded by read timeout", d)
+	}
+}
@@ -1,6 +1,11 @@
 package sentinelClient
 
-import "sync/atomic"
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/garyburd/redigo/redis"
+)
 
 func (s *sentinelClient) getPubSubStatus() int32 {
 	return atomic.LoadInt32(&s.pubSubStatus)
@@ -10,34 +15,58 @@ func (s *sentinelClient) setPubSubStatus(status int32) {
 	atomic.StoreInt32(&s.pubSubStatus, status)
 }
 
-func (s *sentinelClient) setMasterHost(host string) {
-	s.master.mutex.Lock()
-	defer s.master.mutex.Unlock()
-	s.master.host = host
+// setPubSubConn 替换订阅连接并关闭旧连接, 已关闭时关闭传入的连接并返回errClosed
+// Close先标记关闭再取订阅连接, 这里在锁内检查, 新连接要么被Close关闭要么在这里关闭
+func (s *sentinelClient) setPubSubConn(conn redis.PubSubConn, host string) error {
+	s.pubSubMutex.Lock()
+	defer s.pubSubMutex.Unlock()
+	if s.isClosed() {
+		conn.Close()
+		return errClosed
+	}
+	if s.pubSubConn.Conn != nil {
+		s.pubSubConn.Close()
+	}
+	s.pubSubConn = conn
+	s.sentinelHost = host
+	return nil
 }
 
-func (s *sentinelClient) getMasterHost() string {
-	s.master.mutex.RLock()
-	defer s.master.mutex.RUnlock()
-	return s.master.host
+func (s *sentinelClient) getPubSubConn() redis.PubSubConn {
+	s.pubSubMutex.Lock()
+	defer s.pubSubMutex.Unlock()
+	return s.pubSubConn
 }
 
-func (s *sentinelClient) setSlaverHost(host string) {
-	s.slaver.mutex.Lock()
-	defer s.slaver.mutex.Unlock()
-	s.slaver.host = host
+func (s *sentinelClient) getSentinelHost() string {
+	s.pubSubMutex.Lock()
+	defer s.pubSubMutex.Unlock()
+	return s.sentinelHost
 }
 
-func (s *sentinelClient) getSlaverHost() string {
-	s.slaver.mutex.RLock()
-	defer s.slaver.mutex.RUnlock()
-	return s.slaver.host
+// parseInfo 解析INFO命令返回的key:value
+func parseInfo(info string) map[string]string {
+	m := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			m[line[:i]] = line[i+1:]
+		}
+	}
+	return m
 }
 
-func (s *sentinelClient) setSlaveStatus(status int32) {
-	atomic.StoreInt32(&s.slaver.status, status)
-}
+// errorConn 获取连接失败时返回, 所有操作都返回err
+type errorConn struct{ err error }
 
-func (s *sentinelClient) getSlaveStatus() int32 {
-	return atomic.LoadInt32(&s.slaver.status)
-}
+var _ redis.Conn = errorConn{}
+
+func (ec errorConn) Do(string, ...interface{}) (interface{}, error) { return nil, ec.err }
+func (ec errorConn) Send(string, ...interface{}) error              { return ec.err }
+func (ec errorConn) Err() error                                     { return ec.err }
+func (ec errorConn) Close() error                                   { return nil }
+func (ec errorConn) Flush() error                                   { return ec.err }
+func (ec errorConn) Receive() (interface{}, error)                  { return nil, ec.err }
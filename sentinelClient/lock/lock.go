@@ -0,0 +1,293 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+	"gzoo/sentinelClient"
+)
+
+var (
+	// ErrNotObtained 锁被其他持有者占用
+	ErrNotObtained = errors.New("lock not obtained")
+	// ErrLockLost 锁已过期或被其他持有者获取, 主从切换丢失未同步的写入时也会出现
+	// 切换后新持有者的fencing token更大, 资源方会拒绝旧持有者的写入
+	ErrLockLost = errors.New("lock lost")
+	// ErrFailover 加锁期间发生主从切换, 已尝试释放, Obtain会重试
+	ErrFailover = errors.New("failover during obtain")
+
+	errFenceOverflow = errors.New("fence counter overflow")
+)
+
+// fenceCounterBits fencing token低位为fencing key计数, 高位为config-epoch
+const fenceCounterBits = 32
+
+var (
+	// obtainScript SET NX PX加锁, 成功后INCR fencing key返回计数, 被占用返回0
+	obtainScript = redis.NewScript(2, `
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+
+	// extendScript token一致时续期, 否则返回0
+	extendScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseScript token一致时删除, 否则返回0
+	releaseScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// Client 加锁用到的客户端方法
+type Client interface {
+	EvalScript(ctx context.Context, masterName string, script *redis.Script, keysAndArgs ...interface{}) (interface{}, error)
+	ConfigEpoch(masterName string) (int64, error)
+}
+
+var _ Client = sentinelClient.SentinelClient(nil)
+
+// Locker 在master-name对应的master上加锁
+type Locker struct {
+	client     Client
+	masterName string
+	options    Options
+}
+
+// NewLocker 创建Locker, client一般为sentinelClient.SentinelClient
+func NewLocker(client Client, masterName string, opts ...Option) *Locker {
+	l := &Locker{client: client, masterName: masterName, options: defaultOptions}
+	for _, o := range opts {
+		o(&l.options)
+	}
+	l.options.checkOptions()
+	return l
+}
+
+// Obtain 加锁, 锁被占用或加锁期间主从切换时每retryInterval重试一次, 直到加锁成功或ctx结束
+func (l *Locker) Obtain(ctx context.Context, key string) (*Lock, error) {
+	for {
+		lk, err := l.TryObtain(ctx, key)
+		if err != ErrNotObtained && err != ErrFailover {
+			return lk, err
+		}
+
+		timer := time.NewTimer(l.options.retryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryObtain 加锁一次, 锁被占用时返回ErrNotObtained, 加锁前后config-epoch不一致时返回ErrFailover
+func (l *Locker) TryObtain(ctx context.Context, key string) (*Lock, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	epoch, err := l.client.ConfigEpoch(l.masterName)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	counter, err := redis.Int64(l.client.EvalScript(ctx, l.masterName, obtainScript,
+		key, fenceKey(key), token, l.options.ttl.Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+	if counter == 0 {
+		return nil, ErrNotObtained
+	}
+
+	// 加锁期间切换过时不知道计数来自哪个master, 释放后由调用方重试
+	if err = l.checkEpoch(epoch, counter); err != nil {
+		l.client.EvalScript(ctx, l.masterName, releaseScript, key, token)
+		return nil, err
+	}
+	fence := epoch<<fenceCounterBits | counter
+
+	lk := &Lock{
+		l:       l,
+		key:     key,
+		token:   token,
+		fence:   fence,
+		expires: start.Add(l.options.ttl),
+		lost:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if l.options.autoRenew {
+		go lk.renew()
+	} else {
+		close(lk.done)
+	}
+	return lk, nil
+}
+
+// checkEpoch 加锁后config-epoch没变且计数没有溢出到高位
+func (l *Locker) checkEpoch(epoch, counter int64) error {
+	if counter >= 1<<fenceCounterBits {
+		return errFenceOverflow
+	}
+
+	after, err := l.client.ConfigEpoch(l.masterName)
+	if err != nil {
+		return err
+	}
+	if after != epoch {
+		return ErrFailover
+	}
+	return nil
+}
+
+// fenceKey 保存fencing token计数的key, 不过期
+func fenceKey(key string) string {
+	return key + ":fence"
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Lock 持有的锁
+type Lock struct {
+	l        *Locker
+	key      string
+	token    string
+	fence    int64
+	mutex    sync.Mutex
+	expires  time.Time // 按最后一次成功加锁或续期估算的过期时间
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Key 锁的key
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Token 持有者的随机token
+func (lk *Lock) Token() string {
+	return lk.token
+}
+
+// Fence fencing token, 每次加锁单调递增, 高32位为加锁时sentinel的config-epoch, 低32位为fencing key计数
+// 写共享资源时带上, 资源方拒绝比已见过的更小的token, 避免锁过期后旧持有者的写入
+// 主从切换后config-epoch递增, 新master丢失未同步的INCR时token仍比切换前的大
+// 网络分区时仍在写旧master的持有者不受保护
+func (lk *Lock) Fence() int64 {
+	return lk.fence
+}
+
+// Lost 锁丢失时关闭的chan, 续期发现token不一致或续期失败到估算的过期时间时关闭
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+// Extend 续期为ttl, 锁已丢失时返回ErrLockLost
+func (lk *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	start := time.Now()
+	ok, err := redis.Bool(lk.l.client.EvalScript(ctx, lk.l.masterName, extendScript,
+		lk.key, lk.token, ttl.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		lk.markLost()
+		return ErrLockLost
+	}
+
+	lk.mutex.Lock()
+	lk.expires = start.Add(ttl)
+	lk.mutex.Unlock()
+	return nil
+}
+
+// Release 停止自动续期并释放锁, 锁已丢失时返回ErrLockLost
+func (lk *Lock) Release(ctx context.Context) error {
+	lk.stopOnce.Do(func() {
+		close(lk.stop)
+	})
+	<-lk.done
+
+	ok, err := redis.Bool(lk.l.client.EvalScript(ctx, lk.l.masterName, releaseScript, lk.key, lk.token))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		lk.markLost()
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (lk *Lock) markLost() {
+	lk.lostOnce.Do(func() {
+		close(lk.lost)
+	})
+}
+
+func (lk *Lock) expired() bool {
+	lk.mutex.Lock()
+	defer lk.mutex.Unlock()
+	return !time.Now().Before(lk.expires)
+}
+
+// renew 每renewInterval续期一次, 锁丢失或Release时退出
+// 续期出错(如主从切换中)时继续重试, 直到估算的过期时间
+func (lk *Lock) renew() {
+	defer close(lk.done)
+
+	opts := lk.l.options
+	ticker := time.NewTicker(opts.renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-lk.stop:
+			return
+		case <-lk.lost:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), opts.renewInterval)
+		err := lk.Extend(ctx, opts.ttl)
+		cancel()
+		switch {
+		case err == nil:
+		case err == ErrLockLost:
+			opts.logger.Warn("lock lost", logger.F("key", lk.key), logger.F("fence", lk.fence))
+			return
+		case lk.expired():
+			opts.logger.Warn("lock expired, renew failed", logger.F("key", lk.key), logger.F("fence", lk.fence), logger.Err(err))
+			lk.markLost()
+			return
+		default:
+			opts.logger.Warn("renew lock err", logger.F("key", lk.key), logger.Err(err))
+		}
+	}
+}
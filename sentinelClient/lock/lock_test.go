@@ -0,0 +1,255 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// fakeClient 用Go重新实现加锁脚本语义的内存客户端, 按script区分, 回复类型和redis执行lua脚本一致
+// 只测试Locker的加锁/续期/释放逻辑, lua脚本在sentinelClient包的lock_test.go中经EvalScript执行
+type fakeClient struct {
+	mutex        sync.Mutex
+	values       map[string]string
+	expires      map[string]time.Time
+	fences       map[string]int64
+	epoch        int64
+	failoverNext bool  // 为true时下一次加锁后发生主从切换
+	err          error // 非nil时所有调用返回该错误, 模拟主从切换中
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{values: map[string]string{}, expires: map[string]time.Time{}, fences: map[string]int64{}}
+}
+
+func (c *fakeClient) get(key string) (string, bool) {
+	if exp, ok := c.expires[key]; ok && !time.Now().Before(exp) {
+		delete(c.values, key)
+		delete(c.expires, key)
+	}
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// drop 删除key, 模拟主从切换丢失未同步的写入
+func (c *fakeClient) drop(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.values, key)
+}
+
+// failover 模拟主从切换, config-epoch递增, 新master丢失所有未同步的写入
+func (c *fakeClient) failover() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.epoch++
+	c.values = map[string]string{}
+	c.expires = map[string]time.Time{}
+	c.fences = map[string]int64{}
+}
+
+func (c *fakeClient) ConfigEpoch(masterName string) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return -1, c.err
+	}
+	return c.epoch, nil
+}
+
+func (c *fakeClient) setErr(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.err = err
+}
+
+func (c *fakeClient) EvalScript(ctx context.Context, masterName string, script *redis.Script, keysAndArgs ...interface{}) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	key := keysAndArgs[0].(string)
+	switch script {
+	case obtainScript:
+		if _, ok := c.get(key); ok {
+			return int64(0), nil
+		}
+		c.values[key] = keysAndArgs[2].(string)
+		c.expires[key] = time.Now().Add(time.Duration(keysAndArgs[3].(int64)) * time.Millisecond)
+		fence := keysAndArgs[1].(string)
+		c.fences[fence]++
+		if c.failoverNext {
+			c.failoverNext = false
+			c.epoch++
+		}
+		return c.fences[fence], nil
+	case extendScript:
+		if v, ok := c.get(key); !ok || v != keysAndArgs[1].(string) {
+			return int64(0), nil
+		}
+		c.expires[key] = time.Now().Add(time.Duration(keysAndArgs[2].(int64)) * time.Millisecond)
+		return int64(1), nil
+	case releaseScript:
+		if v, ok := c.get(key); !ok || v != keysAndArgs[1].(string) {
+			return int64(0), nil
+		}
+		delete(c.values, key)
+		return int64(1), nil
+	}
+	return nil, errors.New("unknown script")
+}
+
+func TestLocker_ObtainRelease(t *testing.T) {
+	c := newFakeClient()
+	l := NewLocker(c, "mymaster", AutoRenew(false), RetryInterval(5*time.Millisecond), Logger(logger.Nop()))
+	ctx := context.Background()
+
+	lk, err := l.TryObtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk.Fence() != 1 || len(lk.Token()) == 0 {
+		t.Fatalf("fence = %d, token = %q", lk.Fence(), lk.Token())
+	}
+	if _, err = l.TryObtain(ctx, "job"); err != ErrNotObtained {
+		t.Fatalf("err = %v, want %v", err, ErrNotObtained)
+	}
+
+	// 锁被占用时Obtain等到ctx超时
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err = l.Obtain(timeout, "job"); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// 释放后Obtain成功, fencing token递增
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		lk.Release(ctx)
+	}()
+	lk2, err := l.Obtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk2.Fence() != 2 {
+		t.Fatalf("fence = %d, want 2", lk2.Fence())
+	}
+
+	// 旧持有者不能续期或释放新持有者的锁
+	if err = lk.Extend(ctx, time.Second); err != ErrLockLost {
+		t.Fatalf("extend err = %v, want %v", err, ErrLockLost)
+	}
+	if err = lk.Release(ctx); err != ErrLockLost {
+		t.Fatalf("release err = %v, want %v", err, ErrLockLost)
+	}
+	if err = lk2.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLock_AutoRenew(t *testing.T) {
+	c := newFakeClient()
+	l := NewLocker(c, "mymaster", TTL(60*time.Millisecond), RenewInterval(10*time.Millisecond), Logger(logger.Nop()))
+	ctx := context.Background()
+
+	lk, err := l.TryObtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过ttl仍然持有
+	time.Sleep(120 * time.Millisecond)
+	select {
+	case <-lk.Lost():
+		t.Fatal("lock lost while renewing")
+	default:
+	}
+	if _, err = l.TryObtain(ctx, "job"); err != ErrNotObtained {
+		t.Fatalf("err = %v, want %v", err, ErrNotObtained)
+	}
+
+	// 主从切换丢失锁后续期发现并通知
+	c.drop("job")
+	select {
+	case <-lk.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost not notified")
+	}
+	if err = lk.Release(ctx); err != ErrLockLost {
+		t.Fatalf("err = %v, want %v", err, ErrLockLost)
+	}
+}
+
+func TestLock_RenewUntilExpired(t *testing.T) {
+	c := newFakeClient()
+	l := NewLocker(c, "mymaster", TTL(50*time.Millisecond), RenewInterval(10*time.Millisecond), Logger(logger.Nop()))
+
+	lk, err := l.TryObtain(context.Background(), "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 续期一直出错时, 到估算的过期时间认为锁已丢失
+	start := time.Now()
+	c.setErr(errors.New("READONLY You can't write against a read only replica."))
+	select {
+	case <-lk.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost not notified")
+	}
+	if time.Since(start) > 200*time.Millisecond {
+		t.Fatalf("lost after %v, want about ttl", time.Since(start))
+	}
+}
+
+func TestLock_FenceAfterFailover(t *testing.T) {
+	c := newFakeClient()
+	c.epoch = 3
+	l := NewLocker(c, "mymaster", AutoRenew(false), Logger(logger.Nop()))
+	ctx := context.Background()
+
+	lk, err := l.TryObtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk.Fence() != 3<<32|1 {
+		t.Fatalf("fence = %d, want epoch 3 counter 1", lk.Fence())
+	}
+
+	// 新master没有同步到锁和INCR, 新持有者的计数重新从1开始, 但token仍比旧持有者的大
+	c.failover()
+	lk2, err := l.TryObtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk2.Fence() <= lk.Fence() {
+		t.Fatalf("fence after failover = %d, want > %d", lk2.Fence(), lk.Fence())
+	}
+	if err = lk2.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 加锁期间切换时释放并返回ErrFailover, Obtain重试成功
+	c.failoverNext = true
+	if _, err = l.TryObtain(ctx, "job"); err != ErrFailover {
+		t.Fatalf("err = %v, want %v", err, ErrFailover)
+	}
+	if _, ok := c.values["job"]; ok {
+		t.Fatal("lock not released after failover during obtain")
+	}
+	c.failoverNext = true
+	lk3, err := l.Obtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk3.Fence()>>32 != 6 {
+		t.Fatalf("fence = %d, want epoch 6", lk3.Fence())
+	}
+}
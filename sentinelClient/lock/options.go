@@ -0,0 +1,71 @@
+package lock
+
+import (
+	"time"
+
+	"gzoo/common/logger"
+)
+
+var (
+	defaultOptions = Options{
+		ttl:           10 * time.Second,
+		retryInterval: 100 * time.Millisecond,
+		autoRenew:     true,
+		logger:        logger.Default(),
+	}
+)
+
+type Options struct {
+	ttl           time.Duration // 锁的过期时间
+	retryInterval time.Duration // Obtain锁被占用时的重试间隔
+	autoRenew     bool          // 是否后台自动续期
+	renewInterval time.Duration // 自动续期间隔, <=0时为ttl/3
+	logger        logger.Logger // 日志, 默认只输出warn及以上
+}
+
+type Option func(*Options)
+
+func TTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.ttl = ttl
+	}
+}
+
+func RetryInterval(retryInterval time.Duration) Option {
+	return func(o *Options) {
+		o.retryInterval = retryInterval
+	}
+}
+
+func AutoRenew(autoRenew bool) Option {
+	return func(o *Options) {
+		o.autoRenew = autoRenew
+	}
+}
+
+func RenewInterval(renewInterval time.Duration) Option {
+	return func(o *Options) {
+		o.renewInterval = renewInterval
+	}
+}
+
+func Logger(l logger.Logger) Option {
+	return func(o *Options) {
+		o.logger = l
+	}
+}
+
+func (o *Options) checkOptions() {
+	if o.logger == nil {
+		o.logger = logger.Default()
+	}
+	if o.ttl <= 0 {
+		o.ttl = defaultOptions.ttl
+	}
+	if o.retryInterval <= 0 {
+		o.retryInterval = defaultOptions.retryInterval
+	}
+	if o.renewInterval <= 0 || o.renewInterval >= o.ttl {
+		o.renewInterval = o.ttl / 3
+	}
+}
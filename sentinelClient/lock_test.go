@@ -0,0 +1,73 @@
+package sentinelClient_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gzoo/common/logger"
+	"gzoo/sentinelClient"
+	"gzoo/sentinelClient/lock"
+)
+
+// TestLock_Scripts 经EvalScript在fake master上执行lock包真实的lua脚本
+func TestLock_Scripts(t *testing.T) {
+	env := sentinelClient.NewLuaTestEnv(t, "mymaster", 2)
+	defer env.Close()
+
+	ctx := context.Background()
+	l := lock.NewLocker(env.Client, "mymaster", lock.AutoRenew(false), lock.TTL(time.Second), lock.Logger(logger.Nop()))
+
+	lk, err := l.TryObtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk.Fence() != 2<<32|1 {
+		t.Fatalf("fence = %d, want epoch 2 counter 1", lk.Fence())
+	}
+	if v, ok := env.Get("job"); !ok || v != lk.Token() {
+		t.Fatalf("lock value = %q, want token %q", v, lk.Token())
+	}
+	if v, _ := env.Get("job:fence"); v != "1" {
+		t.Fatalf("fence counter = %q, want 1", v)
+	}
+	if _, err = l.TryObtain(ctx, "job"); err != lock.ErrNotObtained {
+		t.Fatalf("err = %v, want %v", err, lock.ErrNotObtained)
+	}
+	if err = lk.Extend(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = lk.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := env.Get("job"); ok {
+		t.Fatal("lock not deleted after release")
+	}
+
+	lk, err = l.TryObtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk.Fence() != 2<<32|2 {
+		t.Fatalf("fence = %d, want epoch 2 counter 2", lk.Fence())
+	}
+
+	// 新master没有锁和fencing计数, 切换后的持有者token仍然更大, 旧持有者续期和释放都发现锁丢失
+	env.Failover()
+	lk2, err := l.TryObtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lk2.Fence() <= lk.Fence() {
+		t.Fatalf("fence after failover = %d, want > %d", lk2.Fence(), lk.Fence())
+	}
+	if err = lk.Extend(ctx, time.Minute); err != lock.ErrLockLost {
+		t.Fatalf("extend err = %v, want %v", err, lock.ErrLockLost)
+	}
+	if err = lk.Release(ctx); err != lock.ErrLockLost {
+		t.Fatalf("release err = %v, want %v", err, lock.ErrLockLost)
+	}
+	if err = lk2.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
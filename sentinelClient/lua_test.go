@@ -0,0 +1,295 @@
+package sentinelClient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeLuaRedis 能执行简单lua脚本的master, 按脚本原文解释执行, 用于测试真实的脚本文本
+// 只支持if/then/end, return, ==, KEYS/ARGV和redis.call(GET/SET/INCR/PEXPIRE/DEL)
+type fakeLuaRedis struct {
+	mutex   sync.Mutex
+	scripts map[string]string
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeLuaRedis() *fakeLuaRedis {
+	return &fakeLuaRedis{scripts: map[string]string{}, values: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+// get 读取未过期的key
+func (r *fakeLuaRedis) get(key string) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.lookup(key)
+}
+
+func (r *fakeLuaRedis) handle(args []string) interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "SCRIPT":
+		return []byte(r.load(args[2]))
+	case "EVALSHA":
+		src, ok := r.scripts[args[1]]
+		if !ok {
+			return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return r.eval(src, args[2:])
+	case "EVAL":
+		r.load(args[1])
+		return r.eval(args[1], args[2:])
+	}
+	return fakeRedis("master")(args)
+}
+
+func (r *fakeLuaRedis) load(src string) string {
+	sum := sha1.Sum([]byte(src))
+	hash := hex.EncodeToString(sum[:])
+	r.scripts[hash] = src
+	return hash
+}
+
+// eval 执行脚本, 脚本出错或redis.call出错时返回错误回复
+func (r *fakeLuaRedis) eval(src string, args []string) (reply interface{}) {
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || n > len(args)-1 {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			err, ok := e.(error)
+			if !ok {
+				panic(e)
+			}
+			reply = err
+		}
+	}()
+
+	p := &luaParser{r: r, tokens: luaTokenRegexp.FindAllString(src, -1), keys: args[1 : 1+n], argv: args[1+n:]}
+	v, _ := p.block(true)
+	if p.pos != len(p.tokens) {
+		p.fail("unexpected '%s'", p.tokens[p.pos])
+	}
+	return luaToReply(v)
+}
+
+func (r *fakeLuaRedis) lookup(key string) (string, bool) {
+	if exp, ok := r.expires[key]; ok && !time.Now().Before(exp) {
+		delete(r.values, key)
+		delete(r.expires, key)
+	}
+	v, ok := r.values[key]
+	return v, ok
+}
+
+// call 执行redis.call, 返回值按redis到lua的规则转换: nil为false, 状态回复为luaStatus
+func (r *fakeLuaRedis) call(args []string) interface{} {
+	key := args[1]
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if v, ok := r.lookup(key); ok {
+			return v
+		}
+		return false
+	case "SET":
+		var nx bool
+		var px int64
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				i++
+				px, _ = strconv.ParseInt(args[i], 10, 64)
+			}
+		}
+		if _, ok := r.lookup(key); ok && nx {
+			return false
+		}
+		r.values[key] = args[2]
+		delete(r.expires, key)
+		if px > 0 {
+			r.expires[key] = time.Now().Add(time.Duration(px) * time.Millisecond)
+		}
+		return luaStatus("OK")
+	case "INCR":
+		v, _ := r.lookup(key)
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil && len(v) > 0 {
+			panic(errors.New("ERR value is not an integer or out of range"))
+		}
+		n++
+		r.values[key] = strconv.FormatInt(n, 10)
+		return n
+	case "PEXPIRE":
+		if _, ok := r.lookup(key); !ok {
+			return int64(0)
+		}
+		ms, _ := strconv.ParseInt(args[2], 10, 64)
+		r.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return int64(1)
+	case "DEL":
+		var n int64
+		for _, k := range args[1:] {
+			if _, ok := r.lookup(k); ok {
+				delete(r.values, k)
+				delete(r.expires, k)
+				n++
+			}
+		}
+		return n
+	}
+	panic(fmt.Errorf("ERR unknown command '%s' called from script", args[0]))
+}
+
+// luaStatus redis状态回复在lua中的值
+type luaStatus string
+
+var luaTokenRegexp = regexp.MustCompile(`'[^']*'|"[^"]*"|\w+(?:\.\w+)*|==|\S`)
+
+// luaParser 边解析边执行, exec为false时只解析不执行, 用于跳过不满足条件的分支和return之后的语句
+type luaParser struct {
+	r      *fakeLuaRedis
+	tokens []string
+	pos    int
+	keys   []string
+	argv   []string
+}
+
+func (p *luaParser) fail(format string, args ...interface{}) {
+	panic(fmt.Errorf("ERR fake lua: "+format, args...))
+}
+
+func (p *luaParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *luaParser) next() string {
+	tok := p.peek()
+	if len(tok) == 0 {
+		p.fail("unexpected end of script")
+	}
+	p.pos++
+	return tok
+}
+
+func (p *luaParser) expect(tok string) {
+	if got := p.next(); got != tok {
+		p.fail("got '%s', want '%s'", got, tok)
+	}
+}
+
+// block 执行到end或脚本结尾, 返回第一个执行到的return的值
+func (p *luaParser) block(exec bool) (reply interface{}, returned bool) {
+	for tok := p.peek(); len(tok) > 0 && tok != "end"; tok = p.peek() {
+		switch p.next() {
+		case "if":
+			cond := p.expr(exec)
+			p.expect("then")
+			v, ok := p.block(exec && cond != false)
+			p.expect("end")
+			if ok {
+				reply, returned, exec = v, true, false
+			}
+		case "return":
+			v := p.expr(exec)
+			if exec {
+				reply, returned, exec = v, true, false
+			}
+		default:
+			p.fail("unsupported statement '%s'", tok)
+		}
+	}
+	return reply, returned
+}
+
+func (p *luaParser) expr(exec bool) interface{} {
+	v := p.primary(exec)
+	if p.peek() == "==" {
+		p.next()
+		w := p.primary(exec)
+		return v == w
+	}
+	return v
+}
+
+func (p *luaParser) primary(exec bool) interface{} {
+	tok := p.next()
+	switch {
+	case tok == "redis.call":
+		p.expect("(")
+		args := []string{luaToString(p.expr(exec))}
+		for p.peek() == "," {
+			p.next()
+			args = append(args, luaToString(p.expr(exec)))
+		}
+		p.expect(")")
+		if !exec {
+			return nil
+		}
+		return p.r.call(args)
+	case tok == "KEYS" || tok == "ARGV":
+		list := p.keys
+		if tok == "ARGV" {
+			list = p.argv
+		}
+		p.expect("[")
+		i, err := strconv.Atoi(p.next())
+		if err != nil {
+			p.fail("bad index")
+		}
+		p.expect("]")
+		if i < 1 || i > len(list) {
+			return false
+		}
+		return list[i-1]
+	case tok[0] == '\'' || tok[0] == '"':
+		return tok[1 : len(tok)-1]
+	}
+
+	n, err := strconv.ParseInt(tok, 10, 64)
+	if err != nil {
+		p.fail("unsupported expression '%s'", tok)
+	}
+	return n
+}
+
+func luaToString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
+
+// luaToReply lua返回值转为redis回复: false为nil, true为1, 字符串为bulk
+func luaToReply(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return nil
+	case string:
+		return []byte(v)
+	case luaStatus:
+		return string(v)
+	}
+	return v
+}
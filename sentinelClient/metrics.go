@@ -0,0 +1,375 @@
+package sentinelClient
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// metricsBuckets 借连接和命令耗时的直方图分桶, 单位秒
+var metricsBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// metricKey 指标按master-name和角色区分
+type metricKey struct {
+	master string
+	role   string
+}
+
+// histogram 累积直方图, counts[i]为落在第i个分桶内的次数, 输出时再累加, 各字段原子更新
+type histogram struct {
+	count  uint64   // 总次数, 放在开头保证32位平台上原子操作对齐
+	sum    uint64   // 总耗时, 单位纳秒
+	counts []uint64 // 各分桶次数
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(metricsBuckets))}
+}
+
+// observe 先加总次数再加分桶, snapshot先读分桶再读总次数, 保证+Inf不小于各分桶
+func (h *histogram) observe(d time.Duration) {
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+	if i := sort.SearchFloat64s(metricsBuckets, d.Seconds()); i < len(metricsBuckets) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+}
+
+// histogramSnapshot 直方图副本
+type histogramSnapshot struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) snapshot() histogramSnapshot {
+	hs := histogramSnapshot{counts: make([]uint64, len(h.counts))}
+	for i := range h.counts {
+		hs.counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	hs.sum = time.Duration(atomic.LoadUint64(&h.sum)).Seconds()
+	hs.count = atomic.LoadUint64(&h.count)
+	return hs
+}
+
+// seriesMetrics 一组master-name/角色的指标, 借连接时取一次, 之后执行命令不加锁
+type seriesMetrics struct {
+	commands       uint64
+	errors         uint64
+	borrowWait     *histogram
+	commandLatency *histogram
+}
+
+func newSeriesMetrics() *seriesMetrics {
+	return &seriesMetrics{borrowWait: newHistogram(), commandLatency: newHistogram()}
+}
+
+func (sm *seriesMetrics) command(latency time.Duration, err error) {
+	atomic.AddUint64(&sm.commands, 1)
+	if err != nil {
+		atomic.AddUint64(&sm.errors, 1)
+	}
+	sm.commandLatency.observe(latency)
+}
+
+// seriesSnapshot 一组master-name/角色的指标副本
+type seriesSnapshot struct {
+	commands       uint64
+	errors         uint64
+	borrowWait     histogramSnapshot
+	commandLatency histogramSnapshot
+}
+
+// metrics 客户端借连接和执行命令的指标
+type metrics struct {
+	mutex  sync.RWMutex
+	series map[metricKey]*seriesMetrics
+}
+
+// get 获取一组master-name/角色的指标, 不存在时创建
+func (m *metrics) get(key metricKey) *seriesMetrics {
+	m.mutex.RLock()
+	sm, ok := m.series[key]
+	m.mutex.RUnlock()
+	if ok {
+		return sm
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.series == nil {
+		m.series = make(map[metricKey]*seriesMetrics)
+	}
+	if sm, ok = m.series[key]; !ok {
+		sm = newSeriesMetrics()
+		m.series[key] = sm
+	}
+	return sm
+}
+
+// snapshot 按master-name/角色排序的指标副本
+func (m *metrics) snapshot() ([]metricKey, map[metricKey]seriesSnapshot) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := make([]metricKey, 0, len(m.series))
+	series := make(map[metricKey]seriesSnapshot, len(m.series))
+	for key, sm := range m.series {
+		keys = append(keys, key)
+		series[key] = seriesSnapshot{
+			commands:       atomic.LoadUint64(&sm.commands),
+			errors:         atomic.LoadUint64(&sm.errors),
+			borrowWait:     sm.borrowWait.snapshot(),
+			commandLatency: sm.commandLatency.snapshot(),
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].master != keys[j].master {
+			return keys[i].master < keys[j].master
+		}
+		return keys[i].role < keys[j].role
+	})
+	return keys, series
+}
+
+// instrument 记录借连接耗时, 借到的连接记录命令数/错误数/耗时
+func (m *metrics) instrument(conn redis.Conn, err error, key metricKey, start time.Time) (redis.Conn, error) {
+	sm := m.get(key)
+	sm.borrowWait.observe(time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	return &metricsConn{Conn: conn, sm: sm}, nil
+}
+
+// metricsConn 记录命令指标的连接
+// Send的命令在收到回复时才记录, 耗时从Send算起, 错误按回复计
+type metricsConn struct {
+	redis.Conn
+	sm      *seriesMetrics
+	pending []time.Time // 已Send还没收到回复的命令的发送时间
+}
+
+func (c *metricsConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := c.Conn.Do(commandName, args...)
+	c.recordDo(start, commandName, reply, err)
+	return reply, err
+}
+
+func (c *metricsConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	c.recordDo(start, commandName, reply, err)
+	return reply, err
+}
+
+// recordDo 记录Do执行的命令和Do接收的之前Send的命令
+func (c *metricsConn) recordDo(start time.Time, commandName string, reply interface{}, err error) {
+	now := time.Now()
+
+	// Do会先接收之前Send的所有回复
+	pending := c.pending
+	c.pending = nil
+
+	// 空命令只flush并接收pipeline的回复, 回复中的错误按命令分别计
+	if commandName == "" {
+		replies, _ := reply.([]interface{})
+		for i, sent := range pending {
+			replyErr := err
+			if err == nil && i < len(replies) {
+				if e, ok := replies[i].(redis.Error); ok {
+					replyErr = e
+				}
+			}
+			c.sm.command(now.Sub(sent), replyErr)
+		}
+		return
+	}
+
+	// 有pipeline时redigo返回其中第一个命令错误, 计入本命令, 连接错误则都算失败
+	var pendingErr error
+	if _, ok := err.(redis.Error); !ok {
+		pendingErr = err
+	}
+	for _, sent := range pending {
+		c.sm.command(now.Sub(sent), pendingErr)
+	}
+	// EXEC执行时出错的命令在回复中, 也算事务出错
+	cmdErr := err
+	if replies, ok := reply.([]interface{}); ok && err == nil && strings.EqualFold(commandName, "EXEC") {
+		for _, r := range replies {
+			if e, ok := r.(redis.Error); ok {
+				cmdErr = e
+				break
+			}
+		}
+	}
+	c.sm.command(now.Sub(start), cmdErr)
+}
+
+func (c *metricsConn) Send(commandName string, args ...interface{}) error {
+	err := c.Conn.Send(commandName, args...)
+	if err != nil {
+		atomic.AddUint64(&c.sm.commands, 1)
+		atomic.AddUint64(&c.sm.errors, 1)
+		return err
+	}
+	c.pending = append(c.pending, time.Now())
+	return nil
+}
+
+func (c *metricsConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	c.recordReceive(err)
+	return reply, err
+}
+
+func (c *metricsConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	c.recordReceive(err)
+	return reply, err
+}
+
+// recordReceive 记录最早一条Send的命令, 没有对应的Send(如订阅消息)不计入命令
+func (c *metricsConn) recordReceive(err error) {
+	if len(c.pending) > 0 {
+		sent := c.pending[0]
+		c.pending = c.pending[1:]
+		c.sm.command(time.Since(sent), err)
+	}
+}
+
+// MetricsHandler prometheus文本格式的指标, 包括连接池活跃/空闲数, 命令/错误/切换/重连次数, 借连接和命令耗时分布
+func (s *sentinelClient) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		s.writeMetrics(bw)
+		bw.Flush()
+	})
+}
+
+func (s *sentinelClient) writeMetrics(w *bufio.Writer) {
+	stats := s.Stats()
+	names := make([]string, 0, len(stats.Groups))
+	for name := range stats.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeHeader(w, "sentinel_client_pool_active_connections", "gauge", "连接池连接数, 包括借出和空闲的")
+	for _, name := range names {
+		gs := stats.Groups[name]
+		writeSample(w, "sentinel_client_pool_active_connections", poolLabels(name, "master", gs.Master.Host), float64(gs.Master.ActiveCount))
+		for _, r := range gs.Replicas {
+			writeSample(w, "sentinel_client_pool_active_connections", poolLabels(name, "slave", r.Host), float64(r.ActiveCount))
+		}
+	}
+
+	writeHeader(w, "sentinel_client_pool_idle_connections", "gauge", "连接池空闲连接数")
+	for _, name := range names {
+		gs := stats.Groups[name]
+		writeSample(w, "sentinel_client_pool_idle_connections", poolLabels(name, "master", gs.Master.Host), float64(gs.Master.IdleCount))
+		for _, r := range gs.Replicas {
+			writeSample(w, "sentinel_client_pool_idle_connections", poolLabels(name, "slave", r.Host), float64(r.IdleCount))
+		}
+	}
+
+	writeHeader(w, "sentinel_client_failovers_total", "counter", "完成的主从切换次数")
+	for _, name := range names {
+		writeSample(w, "sentinel_client_failovers_total", labels("master_name", name), float64(stats.Groups[name].Failovers))
+	}
+
+	writeHeader(w, "sentinel_client_sentinel_reconnects_total", "counter", "sentinel订阅重连次数")
+	writeSample(w, "sentinel_client_sentinel_reconnects_total", "", float64(stats.Reconnects))
+
+	keys, series := s.metrics.snapshot()
+
+	writeHeader(w, "sentinel_client_commands_total", "counter", "执行的命令数")
+	for _, key := range keys {
+		writeSample(w, "sentinel_client_commands_total", key.labels(), float64(series[key].commands))
+	}
+
+	writeHeader(w, "sentinel_client_command_errors_total", "counter", "返回错误的命令数")
+	for _, key := range keys {
+		writeSample(w, "sentinel_client_command_errors_total", key.labels(), float64(series[key].errors))
+	}
+
+	writeHeader(w, "sentinel_client_borrow_wait_seconds", "histogram", "从连接池借连接的耗时")
+	for _, key := range keys {
+		sm := series[key]
+		writeHistogram(w, "sentinel_client_borrow_wait_seconds", key.labels(), &sm.borrowWait)
+	}
+
+	writeHeader(w, "sentinel_client_command_duration_seconds", "histogram", "命令耗时")
+	for _, key := range keys {
+		sm := series[key]
+		writeHistogram(w, "sentinel_client_command_duration_seconds", key.labels(), &sm.commandLatency)
+	}
+}
+
+func (k metricKey) labels() string {
+	return labels("master_name", k.master, "role", k.role)
+}
+
+func poolLabels(master, role, addr string) string {
+	return labels("master_name", master, "role", role, "addr", addr)
+}
+
+// labels 按name/value对拼接标签, 如 master_name="mymaster",role="master"
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func writeHeader(w *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(w *bufio.Writer, name, labels string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	w.WriteByte('\n')
+}
+
+func writeHistogram(w *bufio.Writer, name, labels string, h *histogramSnapshot) {
+	var cumulative uint64
+	for i, le := range metricsBuckets {
+		if i < len(h.counts) {
+			cumulative += h.counts[i]
+		}
+		writeSample(w, name+"_bucket", labels+`,le="`+strconv.FormatFloat(le, 'g', -1, 64)+`"`, float64(cumulative))
+	}
+	writeSample(w, name+"_bucket", labels+`,le="+Inf"`, float64(h.count))
+	writeSample(w, name+"_sum", labels, h.sum)
+	writeSample(w, name+"_count", labels, float64(h.count))
+}
@@ -0,0 +1,176 @@
+package sentinelClient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram()
+	h.observe(100 * time.Microsecond)
+	h.observe(time.Millisecond)
+	h.observe(100 * time.Second)
+
+	hs := h.snapshot()
+	if hs.count != 3 || hs.counts[0] != 1 || hs.counts[1] != 1 || hs.sum != 100.0011 {
+		t.Fatalf("histogram = %+v", hs)
+	}
+	var n uint64
+	for _, c := range hs.counts {
+		n += c
+	}
+	if n != 2 {
+		t.Fatalf("bucketed = %d, want 2 (larger than all buckets only in +Inf)", n)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	got := labels("master_name", `a"b\c`, "role", "master")
+	if want := `master_name="a\"b\\c",role="master"`; got != want {
+		t.Fatalf("labels = %s, want %s", got, want)
+	}
+}
+
+func TestSentinelClient_MetricsHandler(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+
+	conn, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Do("PING")
+	conn.Do("UNKNOWN")
+	conn.Close()
+
+	// 没有slave时读master, 计入master
+	conn, err = s.GetSlaverClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Do("PING")
+	conn.Close()
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type = %s", ct)
+	}
+
+	for _, want := range []string{
+		`sentinel_client_pool_active_connections{master_name="mymaster",role="master",addr="` + m.addr() + `"} 1`,
+		`sentinel_client_pool_idle_connections{master_name="mymaster",role="master",addr="` + m.addr() + `"} 1`,
+		`sentinel_client_commands_total{master_name="mymaster",role="master"} 3`,
+		`sentinel_client_command_errors_total{master_name="mymaster",role="master"} 1`,
+		`sentinel_client_failovers_total{master_name="mymaster"} 0`,
+		`sentinel_client_sentinel_reconnects_total 0`,
+		`sentinel_client_borrow_wait_seconds_count{master_name="mymaster",role="master"} 2`,
+		`sentinel_client_command_duration_seconds_bucket{master_name="mymaster",role="master",le="+Inf"} 3`,
+		`# TYPE sentinel_client_command_duration_seconds histogram`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("metrics missing %q\n%s", want, body)
+		}
+	}
+}
+
+func TestSentinelClient_MetricsPipeline(t *testing.T) {
+	store := newFakeTxRedis()
+	m := newFakeServer(t, store.handle)
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+
+	series := func() seriesSnapshot {
+		_, series := s.metrics.snapshot()
+		return series[metricKey{master: "mymaster", role: "master"}]
+	}
+
+	conn, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Send的命令在Receive时记录耗时和错误
+	conn.Send("PING")
+	conn.Send("UNKNOWN")
+	conn.Flush()
+	if sm := series(); sm.commands != 0 || sm.commandLatency.count != 0 {
+		t.Fatalf("counted before reply: %+v", sm)
+	}
+	conn.Receive()
+	conn.Receive()
+	if sm := series(); sm.commands != 2 || sm.errors != 1 || sm.commandLatency.count != 2 {
+		t.Fatalf("after Receive: %+v", sm)
+	}
+
+	// Do("")接收的回复中的错误按命令分别计
+	conn.Send("UNKNOWN")
+	conn.Send("UNKNOWN")
+	if _, err := conn.Do(""); err != nil {
+		t.Fatal(err)
+	}
+	if sm := series(); sm.commands != 4 || sm.errors != 3 || sm.commandLatency.count != 4 {
+		t.Fatalf("after Do(\"\"): %+v", sm)
+	}
+
+	// EXEC回复中的错误计入事务
+	if _, err := s.Tx(context.Background(), "mymaster", nil, func(tx *Tx) error {
+		tx.Queue("UNKNOWN")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sm := series(); sm.errors != 4 {
+		t.Fatalf("after Tx: errors = %d, want 4", sm.errors)
+	}
+}
+
+func TestSentinelClient_MetricsWithTimeout(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+	r := newFakeServer(t, fakeRedis("slave"))
+	defer r.close()
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+	g := s.groups["mymaster"]
+	g.slaves.update(map[string]replicaProbe{r.addr(): {lagOffset: -1, lagSeconds: -1}}, s.createRedisPool)
+
+	for role, get := range map[string]func(context.Context, string) (redis.Conn, error){
+		"master": s.GetMasterClientContext,
+		"slave":  s.GetSlaverClientContext,
+	} {
+		conn, err := get(context.Background(), "mymaster")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply, err := redis.DoWithTimeout(conn, time.Second, "PING"); err != nil || reply != "PONG" {
+			t.Fatalf("%s DoWithTimeout reply = %v, err = %v", role, reply, err)
+		}
+		conn.Send("UNKNOWN")
+		conn.Flush()
+		if _, err := redis.ReceiveWithTimeout(conn, time.Second); err == nil {
+			t.Fatalf("%s ReceiveWithTimeout err = nil", role)
+		}
+		conn.Close()
+
+		_, series := s.metrics.snapshot()
+		if sm := series[metricKey{master: "mymaster", role: role}]; sm.commands != 2 || sm.errors != 1 || sm.commandLatency.count != 2 {
+			t.Fatalf("%s metrics = %+v", role, sm)
+		}
+	}
+}
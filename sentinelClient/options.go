@@ -1,34 +1,60 @@
 package sentinelClient
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
 )
 
 var (
 	defaultOptions = Options{
-		maxIdle:               8,
-		maxActive:             16,
-		dialConnTimeout:       3 * time.Second,
-		dialTimeout:           3 * time.Second,
-		idleCheckTime:         3 * time.Second,
-		monitorStatusDuration: 3 * time.Second,
-		switchMasterHook:      nil,
+		maxIdle:                 8,
+		maxActive:               16,
+		dialConnTimeout:         3 * time.Second,
+		dialTimeout:             3 * time.Second,
+		idleCheckTime:           3 * time.Second,
+		monitorStatusDuration:   3 * time.Second,
+		topologyRefreshDuration: 30 * time.Second,
+		switchMasterHook:        nil,
+		drainTimeout:            10 * time.Second,
+		logger:                  logger.Default(),
+		retryPolicy:             defaultRetryPolicy,
+		batchChunkSize:          100,
+		maxTxRetries:            3,
 	}
 )
 
 type Options struct {
-	sentinelHosts         []string           // sentinel host列表
-	masterName            string             // master-name
-	maxIdle               int                // 连接池 最大空闲连接
-	maxActive             int                // 连接池 最大活跃连接
-	redisOptions          []redis.DialOption // redis参数
-	dialConnTimeout       time.Duration      // 建立连接超时
-	dialTimeout           time.Duration      // 读写超时
-	idleCheckTime         time.Duration      // 空闲检查时间间隔
-	monitorStatusDuration time.Duration      // 监控sentinel/slave状态时间间隔
-	switchMasterHook      SwitchMasterHook   // 发生主从切换时的钩子
+	sentinelHosts           []string           // sentinel host列表
+	masterNames             []string           // master-name列表
+	maxIdle                 int                // 连接池 最大空闲连接
+	maxActive               int                // 连接池 最大活跃连接
+	redisOptions            []redis.DialOption // redis参数
+	dialConnTimeout         time.Duration      // 建立连接超时
+	dialTimeout             time.Duration      // 读写超时
+	idleCheckTime           time.Duration      // 空闲检查时间间隔
+	monitorStatusDuration   time.Duration      // 监控sentinel/slave状态时间间隔
+	topologyRefreshDuration time.Duration      // 从sentinel刷新slave列表/发现sentinel的时间间隔, sentinel事件也会触发刷新
+	switchMasterHook        SwitchMasterHook   // 发生主从切换时的钩子
+	balancer                Balancer           // slave负载均衡策略
+	maxSlaveLagOffset       int64              // slave最大落后master的复制偏移量, <=0不限制
+	maxSlaveLag             time.Duration      // slave最大未和master通讯时长, <=0不限制
+	masterQuorum            int                // 获取master地址时要求一致的sentinel数, 须超过配置的sentinel数的一半, <=0只问一个sentinel
+	drainTimeout            time.Duration      // 主从切换后等待旧master连接归还的时长
+	drainHook               DrainHook          // 旧master连接池排空后的钩子
+	sentinelUsername        string             // sentinel ACL用户名
+	sentinelPassword        string             // sentinel密码
+	redisUsername           string             // redis数据节点ACL用户名
+	redisPassword           string             // redis数据节点密码
+	sentinelTLSConfig       *tls.Config        // sentinel tls配置, nil不使用tls
+	redisTLSConfig          *tls.Config        // redis数据节点tls配置, nil不使用tls
+	logger                  logger.Logger      // 日志, 默认只输出warn及以上
+	retryPolicy             RetryPolicy        // Do的重试策略
+	batchChunkSize          int                // ExecBatch每次流水线的命令数, <=0不分段
+	maxTxRetries            int                // Tx中WATCH的key被修改时的最大重试次数
+	readyRequireReplica     bool               // 就绪检查是否要求每个主从组有可用slave
 }
 
 func SentinelHosts(sentinelHosts []string) Option {
@@ -39,7 +65,13 @@ func SentinelHosts(sentinelHosts []string) Option {
 
 func MasterName(masterName string) Option {
 	return func(o *Options) {
-		o.masterName = masterName
+		o.masterNames = append(o.masterNames, masterName)
+	}
+}
+
+func MasterNames(masterNames []string) Option {
+	return func(o *Options) {
+		o.masterNames = append(o.masterNames, masterNames...)
 	}
 }
 
@@ -85,8 +117,118 @@ func MonitorStatusDuration(monitorStatusDuration time.Duration) Option {
 	}
 }
 
+func TopologyRefreshDuration(topologyRefreshDuration time.Duration) Option {
+	return func(o *Options) {
+		o.topologyRefreshDuration = topologyRefreshDuration
+	}
+}
+
 func SwitchMasterCallback(switchMasterCallback SwitchMasterHook) Option {
 	return func(o *Options) {
 		o.switchMasterHook = switchMasterCallback
 	}
 }
+
+func SlaveBalancer(balancer Balancer) Option {
+	return func(o *Options) {
+		o.balancer = balancer
+	}
+}
+
+func MaxSlaveLagOffset(maxSlaveLagOffset int64) Option {
+	return func(o *Options) {
+		o.maxSlaveLagOffset = maxSlaveLagOffset
+	}
+}
+
+func MaxSlaveLag(maxSlaveLag time.Duration) Option {
+	return func(o *Options) {
+		o.maxSlaveLag = maxSlaveLag
+	}
+}
+
+func MasterQuorum(masterQuorum int) Option {
+	return func(o *Options) {
+		o.masterQuorum = masterQuorum
+	}
+}
+
+func DrainTimeout(drainTimeout time.Duration) Option {
+	return func(o *Options) {
+		o.drainTimeout = drainTimeout
+	}
+}
+
+func DrainCallback(drainCallback DrainHook) Option {
+	return func(o *Options) {
+		o.drainHook = drainCallback
+	}
+}
+
+func SentinelUsername(sentinelUsername string) Option {
+	return func(o *Options) {
+		o.sentinelUsername = sentinelUsername
+	}
+}
+
+func SentinelPassword(sentinelPassword string) Option {
+	return func(o *Options) {
+		o.sentinelPassword = sentinelPassword
+	}
+}
+
+func RedisUsername(redisUsername string) Option {
+	return func(o *Options) {
+		o.redisUsername = redisUsername
+	}
+}
+
+func RedisPassword(redisPassword string) Option {
+	return func(o *Options) {
+		o.redisPassword = redisPassword
+	}
+}
+
+func SentinelTLSConfig(sentinelTLSConfig *tls.Config) Option {
+	return func(o *Options) {
+		o.sentinelTLSConfig = sentinelTLSConfig
+	}
+}
+
+func RedisTLSConfig(redisTLSConfig *tls.Config) Option {
+	return func(o *Options) {
+		o.redisTLSConfig = redisTLSConfig
+	}
+}
+
+// Logger 设置日志, 默认只输出warn及以上级别, 不需要日志时用logger.Nop()
+func Logger(l logger.Logger) Option {
+	return func(o *Options) {
+		o.logger = l
+	}
+}
+
+func Retry(retryPolicy RetryPolicy) Option {
+	return func(o *Options) {
+		o.retryPolicy = retryPolicy
+	}
+}
+
+func BatchChunkSize(batchChunkSize int) Option {
+	return func(o *Options) {
+		o.batchChunkSize = batchChunkSize
+	}
+}
+
+func MaxTxRetries(maxTxRetries int) Option {
+	return func(o *Options) {
+		o.maxTxRetries = maxTxRetries
+	}
+}
+
+// ReadyRequireReplica 就绪检查是否要求每个主从组有可用slave, 默认只报告slave状态不影响就绪
+func ReadyRequireReplica(readyRequireReplica bool) Option {
+	return func(o *Options) {
+		o.readyRequireReplica = readyRequireReplica
+	}
+}
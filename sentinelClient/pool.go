@@ -1,12 +1,14 @@
 package sentinelClient
 
 import (
-	"log"
+	"math"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
 )
 
 const (
@@ -14,120 +16,289 @@ const (
 	slave
 )
 
-func (s *sentinelClient) initRedisPool(sentinelHost string, switchRole int, isClose bool) error {
+func (s *sentinelClient) initRedisPool(g *masterGroup, sentinelHost string, switchRole int, isClose bool) error {
 	switch switchRole {
 	case master:
-		return s.initMasterRedisPool(sentinelHost, isClose)
+		return s.initMasterRedisPool(g, sentinelHost, isClose)
 	case slave:
-		return s.initSlaveRedisPool(sentinelHost, isClose)
+		return s.initSlaveRedisPool(g, sentinelHost)
 	default:
-		log.Fatal("init redis role not right, switchRole:", switchRole)
+		return errRole
 	}
-	return nil
 }
 
-func (s *sentinelClient) initMasterRedisPool(sentinelHost string, isClosed bool) error {
-	conn, err := redis.Dial("tcp", sentinelHost)
+func (s *sentinelClient) initMasterRedisPool(g *masterGroup, sentinelHost string, isClosed bool) error {
+	host, err := s.resolveVerifiedMaster(g, sentinelHost)
 	if err != nil {
 		return err
 	}
+
+	s.swapMasterPool(g, host)
+	return nil
+}
+
+// getMasterAddr 通过sentinel获取master地址
+func (s *sentinelClient) getMasterAddr(sentinelHost, masterName string) (string, error) {
+	conn, err := s.dialSentinel(sentinelHost)
+	if err != nil {
+		return "", err
+	}
 	defer conn.Close()
 
-	resp, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.options.masterName))
+	resp, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", masterName))
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if len(resp) != 2 {
-		return errGetInfoBySentinel
+		return "", errGetInfoBySentinel
 	}
 
-	host := net.JoinHostPort(resp[0], resp[1])
+	return net.JoinHostPort(resp[0], resp[1]), nil
+}
 
-	s.master.poolMutex.Lock()
-	if s.master.poolClient != nil {
-		s.master.poolClient.Close()
+// swapMasterPool 替换master连接池, 新借出的连接直接用新master, 旧连接池在后台排空
+func (s *sentinelClient) swapMasterPool(g *masterGroup, host string) {
+	g.master.poolMutex.Lock()
+	old := g.master.poolGen
+	g.master.generation++
+	g.master.poolGen = newPoolGeneration(g.master.generation, host, s.createMasterRedisPool(g, host))
+	// 通知等待新master的Do重试, 先清除下线标记, 被唤醒的重试可以直接用新master
+	g.setMasterDown(false)
+	if g.master.swapped != nil {
+		close(g.master.swapped)
 	}
-	s.master.poolClient = s.createRedisPool(host)
-	s.master.poolMutex.Unlock()
+	g.master.swapped = make(chan struct{})
+	g.master.poolMutex.Unlock()
 
-	s.setMasterHost(host)
+	g.setMasterHost(host)
+
+	if old != nil {
+		s.retireMasterPool(g, old)
+	}
 
-	return err
+	// 新master的脚本缓存可能是空的
+	s.reloadScripts(g)
 }
 
-func (s *sentinelClient) initSlaveRedisPool(sentinelHost string, isClosed bool) error {
-	conn, err := redis.Dial("tcp", sentinelHost)
+func (s *sentinelClient) initSlaveRedisPool(g *masterGroup, sentinelHost string) error {
+	slaveHosts, err := s.getSlaveHosts(g, sentinelHost)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
-	resp, err := redis.Values(conn.Do("SENTINEL", "slaves", s.options.masterName))
+	// 只保留能ping通的slave, 顺便记录延迟和复制进度
+	probes := s.probeSlaves(g, slaveHosts, s.probeMasterOffset(g))
+
+	added, removed := g.slaves.update(probes, s.createRedisPool)
+	g.probes.retain(probes)
+	for _, host := range added {
+		s.options.logger.Info("slave add", logger.F("master", g.name), logger.F("slave", host))
+	}
+	for _, host := range removed {
+		s.options.logger.Info("slave remove", logger.F("master", g.name), logger.F("slave", host))
+	}
+
+	// slave都挂了, GetSlaverClient使用master
+	if len(probes) <= 0 && len(g.getMasterHost()) <= 0 {
+		return errSwitchQuicklyHost
+	}
+
+	return nil
+}
+
+// probeReplicas 用探测长连接刷新在用slave的延迟和复制进度, 不访问sentinel, 探测失败的slave暂不参与读
+func (s *sentinelClient) probeReplicas(g *masterGroup) {
+	hosts := g.slaves.hosts()
+	if len(hosts) == 0 {
+		return
+	}
+
+	probes := s.probeSlaves(g, hosts, s.probeMasterOffset(g))
+	for _, host := range g.slaves.setProbes(probes) {
+		s.options.logger.Warn("slave unreachable", logger.F("master", g.name), logger.F("slave", host))
+	}
+}
+
+// probeMasterOffset 配置了复制偏移量上限时, 取master当前偏移量用于计算slave落后多少, 未配置或获取失败为-1
+func (s *sentinelClient) probeMasterOffset(g *masterGroup) int64 {
+	if s.options.maxSlaveLagOffset <= 0 {
+		return -1
+	}
+
+	offset, err := s.getMasterReplOffset(g)
 	if err != nil {
-		return err
+		s.options.logger.Warn("get master repl offset err", logger.F("master", g.name), logger.Err(err))
+		return -1
+	}
+	return offset
+}
+
+// getSlaveHosts 通过sentinel获取主从组可用于读的slave列表
+func (s *sentinelClient) getSlaveHosts(g *masterGroup, sentinelHost string) ([]string, error) {
+	slaves, err := s.getSlaves(g, sentinelHost)
+	if err != nil {
+		return nil, err
 	}
 
 	var slaveHosts []string
+	for _, slave := range slaves {
+		if !slave.Healthy() {
+			s.options.logger.Debug("slave unhealthy", logger.F("master", g.name), logger.F("slave", slave.Name),
+				logger.F("flags", strings.Join(slave.Flags, ",")), logger.F("link", slave.MasterLinkStatus),
+				logger.F("priority", slave.SlavePriority))
+			continue
+		}
+
+		if !strings.EqualFold(slave.Name, g.getMasterHost()) {
+			slaveHosts = append(slaveHosts, slave.Name)
+		}
+	}
+
+	return slaveHosts, nil
+}
+
+// getSlaves 通过sentinel获取主从组所有slave信息
+func (s *sentinelClient) getSlaves(g *masterGroup, sentinelHost string) ([]ReplicaInfo, error) {
+	conn, err := s.dialSentinel(sentinelHost)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := redis.Values(conn.Do("SENTINEL", "slaves", g.name))
+	if err != nil {
+		return nil, err
+	}
+
+	slaves := make([]ReplicaInfo, 0, len(resp))
 	for _, slave := range resp {
 		slaveM, err := redis.StringMap(slave, nil)
 		if err != nil {
 			continue
 		}
 
-		slaveHost := slaveM["name"]
-		if len(slaveHost) <= 0 {
-			log.Println("this slave no name info, slaveM:", slaveM)
+		info := parseReplicaInfo(slaveM)
+		if len(info.Name) <= 0 {
+			s.options.logger.Warn("slave no name info", logger.F("master", g.name), logger.F("info", slaveM))
 			continue
 		}
 
-		if !strings.EqualFold(slaveHost, s.getMasterHost()) {
-			slaveHosts = append(slaveHosts, slaveHost)
-		}
+		slaves = append(slaves, info)
+	}
+
+	return slaves, nil
+}
+
+// getMasterReplOffset 获取master当前的复制偏移量
+func (s *sentinelClient) getMasterReplOffset(g *masterGroup) (int64, error) {
+	ctx, cancel := s.borrowContext()
+	defer cancel()
+
+	conn, err := s.getMasterConn(ctx, g)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+
+	info, err := redis.String(conn.Do("INFO", "replication"))
+	if err != nil {
+		return -1, err
+	}
+
+	return parseInt64(parseInfo(info)["master_repl_offset"], -1), nil
+}
+
+// probeSlaves 并发探测所有slave, 返回能ping通的slave及其延迟和复制进度
+func (s *sentinelClient) probeSlaves(g *masterGroup, hosts []string, masterOffset int64) map[string]replicaProbe {
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		probes = make(map[string]replicaProbe, len(hosts))
+	)
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			probe, err := s.probeSlave(g, host, masterOffset)
+			if err != nil {
+				s.options.logger.Warn("probe slave err", logger.F("slave", host), logger.Err(err))
+				return
+			}
+
+			mutex.Lock()
+			probes[host] = probe
+			mutex.Unlock()
+		}(host)
 	}
+	wg.Wait()
+
+	return probes
+}
 
-	var quicklySlave string
-	if len(slaveHosts) > 0 {
-		quicklySlave, err = s.switchQuicklyHost(slaveHosts)
+// probeSlave ping一次slave记录耗时(不含建连), 配置了复制延迟上限时再取复制进度
+// 复用上次探测的长连接, 出错时关闭, 下次探测重新建连
+func (s *sentinelClient) probeSlave(g *masterGroup, host string, masterOffset int64) (probe replicaProbe, err error) {
+	conn := g.probes.take(host)
+	if conn == nil {
+		conn, err = s.dialRedis(
+			host,
+			redis.DialConnectTimeout(s.options.dialConnTimeout),
+			redis.DialReadTimeout(s.options.dialTimeout),
+			redis.DialWriteTimeout(s.options.dialTimeout),
+		)
 		if err != nil {
-			return err
+			return replicaProbe{lagOffset: -1, lagSeconds: -1}, err
 		}
 	}
 
-	// slave都挂了, 使用master
-	if len(quicklySlave) <= 0 {
-		quicklySlave = s.getMasterHost()
+	probe, err = s.probeSlaveConn(conn, masterOffset)
+	if err != nil {
+		conn.Close()
+		return probe, err
 	}
+	g.probes.put(host, conn)
+	return probe, nil
+}
 
-	if len(quicklySlave) <= 0 {
-		return errSwitchQuicklyHost
+// probeSlaveConn 在探测连接上ping并取复制进度
+func (s *sentinelClient) probeSlaveConn(conn redis.Conn, masterOffset int64) (replicaProbe, error) {
+	probe := replicaProbe{lagOffset: -1, lagSeconds: -1}
+
+	start := time.Now()
+	if _, err := conn.Do("PING"); err != nil {
+		return probe, err
 	}
+	probe.latency = time.Since(start)
 
-	conn, err = redis.Dial(
-		"tcp",
-		quicklySlave,
-		redis.DialConnectTimeout(s.options.dialConnTimeout),
-		redis.DialReadTimeout(s.options.dialTimeout),
-		redis.DialWriteTimeout(s.options.dialTimeout),
-	)
-	if err != nil {
-		return err
+	if s.options.maxSlaveLagOffset <= 0 && s.options.maxSlaveLag <= 0 {
+		return probe, nil
 	}
 
-	s.slaver.poolMutex.Lock()
-	if s.slaver.poolClient != nil {
-		s.slaver.poolClient.Close()
+	info, err := redis.String(conn.Do("INFO", "replication"))
+	if err != nil {
+		return probe, err
 	}
-	s.slaver.poolClient = s.createRedisPool(quicklySlave)
-	s.slaver.poolMutex.Unlock()
 
-	if isClosed {
-		s.slaver.conn.Close()
+	infoM := parseInfo(info)
+	if offset := parseInt64(infoM["slave_repl_offset"], -1); offset >= 0 && masterOffset >= 0 {
+		probe.lagOffset = masterOffset - offset
+		if probe.lagOffset < 0 {
+			probe.lagOffset = 0
+		}
+	}
+	probe.lagSeconds = parseInt64(infoM["master_last_io_seconds_ago"], -1)
+	// 复制连接断开时master_last_io_seconds_ago为-1, 用断开时长代替
+	if infoM["master_link_status"] == "down" {
+		probe.lagSeconds = parseInt64(infoM["master_link_down_since_seconds"], -1)
+		if probe.lagSeconds < 0 {
+			probe.lagSeconds = math.MaxInt64
+		}
 	}
 
-	s.slaver.conn = conn
-	s.setSlaverHost(quicklySlave)
-	return err
+	return probe, nil
 }
 
 func (s *sentinelClient) createRedisPool(host string) *redis.Pool {
@@ -135,18 +306,19 @@ func (s *sentinelClient) createRedisPool(host string) *redis.Pool {
 		MaxIdle:     s.options.maxIdle,
 		MaxActive:   s.options.maxActive,
 		IdleTimeout: 60 * time.Second,
+		Wait:        true, // 连接池满时等待, 由GetContext的ctx控制等待时长
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
 			if time.Since(t) < s.options.idleCheckTime {
 				return nil
 			}
 			_, err := c.Do("PING")
 			if err != nil {
-				log.Printf("t:%+v err:%+v\n", t, err)
+				s.options.logger.Debug("test on borrow err", logger.F("host", host), logger.Err(err))
 			}
 			return err
 		},
 		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", host, s.options.redisOptions...)
+			c, err := s.dialRedis(host)
 			if err != nil {
 				return nil, err
 			}
@@ -0,0 +1,130 @@
+package sentinelClient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gzoo/common/logger"
+)
+
+// quorumWaitInterval 等待其他sentinel确认新master时重新询问的间隔
+const quorumWaitInterval = 100 * time.Millisecond
+
+// QuorumError 多个sentinel返回的master地址达不到quorum
+type QuorumError struct {
+	MasterName string         // master-name
+	Quorum     int            // 要求一致的sentinel数
+	Votes      map[string]int // master地址 -> 返回该地址的sentinel数
+	Failed     int            // 查询失败的sentinel数
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("%s master quorum %d not reached, votes:%v, failed:%d", e.MasterName, e.Quorum, e.Votes, e.Failed)
+}
+
+// resolveMaster 获取master地址, 配置了quorum时要求多个sentinel一致
+func (s *sentinelClient) resolveMaster(g *masterGroup, sentinelHost string) (string, error) {
+	if s.options.masterQuorum <= 0 {
+		return s.getMasterAddr(sentinelHost, g.name)
+	}
+	return s.resolveMasterByQuorum(g)
+}
+
+// resolveMasterByQuorum 并发询问所有sentinel, 得票最多且达到quorum的地址为master
+func (s *sentinelClient) resolveMasterByQuorum(g *masterGroup) (string, error) {
+	quorumE := s.collectMasterVotes(g)
+
+	var (
+		best  string
+		votes int
+	)
+	for addr, n := range quorumE.Votes {
+		if n > votes {
+			best, votes = addr, n
+		}
+	}
+
+	if votes < quorumE.Quorum {
+		return "", quorumE
+	}
+
+	return best, nil
+}
+
+// verifyMasterByQuorum 校验addr是否得到quorum个sentinel确认
+func (s *sentinelClient) verifyMasterByQuorum(g *masterGroup, addr string) error {
+	quorumE := s.collectMasterVotes(g)
+	if quorumE.Votes[addr] < quorumE.Quorum {
+		return quorumE
+	}
+	return nil
+}
+
+// waitMasterQuorum 等待quorum个sentinel确认addr, 最多等dialTimeout
+// 收到+switch-master时其他sentinel要通过hello消息一两秒后才知道新master, 不能立即拒绝
+func (s *sentinelClient) waitMasterQuorum(g *masterGroup, addr string) error {
+	deadline := time.Now().Add(s.options.dialTimeout)
+	for {
+		err := s.verifyMasterByQuorum(g, addr)
+		if err == nil || !time.Now().Add(quorumWaitInterval).Before(deadline) {
+			return err
+		}
+
+		select {
+		case <-time.After(quorumWaitInterval):
+		case <-s.stop:
+			return err
+		}
+	}
+}
+
+// collectMasterVotes 并发询问所有sentinel的master地址
+func (s *sentinelClient) collectMasterVotes(g *masterGroup) *QuorumError {
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		quorumE = &QuorumError{MasterName: g.name, Quorum: s.options.masterQuorum, Votes: make(map[string]int)}
+	)
+
+	for _, host := range s.getSentinelHosts() {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			addr, err := s.getMasterAddr(host, g.name)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				quorumE.Failed++
+				return
+			}
+			quorumE.Votes[addr]++
+		}(host)
+	}
+	wg.Wait()
+
+	return quorumE
+}
+
+// checkMasterQuorum 定时按quorum校验master, sentinel达成一致的地址和当前不同时切换
+func (s *sentinelClient) checkMasterQuorum(g *masterGroup) {
+	addr, err := s.resolveMasterByQuorum(g)
+	if err != nil {
+		s.options.logger.Warn("check master quorum err", logger.F("master", g.name), logger.Err(err))
+		s.setLastError(err)
+		return
+	}
+
+	if addr == g.getMasterHost() {
+		return
+	}
+
+	if err = s.verifyMasterRole(addr); err != nil {
+		s.options.logger.Warn("verify master role err", logger.F("master", g.name), logger.F("host", addr), logger.Err(err))
+		return
+	}
+
+	s.changeMaster(g, addr)
+}
@@ -0,0 +1,140 @@
+package sentinelClient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQuorumError_Error(t *testing.T) {
+	err := &QuorumError{
+		MasterName: "mymaster",
+		Quorum:     2,
+		Votes:      map[string]int{"10.0.0.1:6379": 1, "10.0.0.2:6379": 1},
+		Failed:     1,
+	}
+	msg := err.Error()
+	for _, s := range []string{"mymaster", "quorum 2", "10.0.0.1:6379:1", "failed:1"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("Error() = %s, missing %s", msg, s)
+		}
+	}
+}
+
+func TestSentinelClient_ResolveMasterByQuorum(t *testing.T) {
+	s1 := newFakeServer(t, fakeSentinel("mymaster", "10.0.0.1:6379"))
+	s2 := newFakeServer(t, fakeSentinel("mymaster", "10.0.0.1:6379"))
+	s3 := newFakeServer(t, fakeSentinel("mymaster", "10.0.0.2:6379"))
+	defer s1.close()
+	defer s2.close()
+	defer s3.close()
+
+	s := &sentinelClient{options: defaultOptions}
+	s.options.masterQuorum = 2
+	s.addSentinelHosts(s1.addr(), s2.addr(), s3.addr())
+	g := newMasterGroup("mymaster")
+
+	addr, err := s.resolveMasterByQuorum(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "10.0.0.1:6379" {
+		t.Fatalf("addr = %s", addr)
+	}
+
+	if err = s.verifyMasterByQuorum(g, "10.0.0.2:6379"); err == nil {
+		t.Fatal("want quorum error for minority address")
+	}
+
+	s.options.masterQuorum = 3
+	if _, err = s.resolveMasterByQuorum(g); err == nil {
+		t.Fatal("want quorum error")
+	} else if qe, ok := err.(*QuorumError); !ok || qe.Votes["10.0.0.2:6379"] != 1 {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSentinelClient_QuorumHungSentinel(t *testing.T) {
+	s1 := newFakeServer(t, fakeSentinel("mymaster", "10.0.0.1:6379"))
+	s2 := newFakeServer(t, fakeSentinel("mymaster", "10.0.0.1:6379"))
+	// 接受连接但不回复的sentinel
+	hang := make(chan struct{})
+	s3 := newFakeServer(t, func(args []string) interface{} {
+		<-hang
+		return errCloseConn
+	})
+	defer s1.close()
+	defer s2.close()
+	defer s3.close()
+	defer close(hang)
+
+	s := &sentinelClient{options: defaultOptions}
+	s.options.masterQuorum = 2
+	s.options.dialTimeout = 50 * time.Millisecond
+	s.addSentinelHosts(s1.addr(), s2.addr(), s3.addr())
+
+	start := time.Now()
+	addr, err := s.resolveMasterByQuorum(newMasterGroup("mymaster"))
+	if err != nil || addr != "10.0.0.1:6379" {
+		t.Fatalf("addr = %s, err = %v", addr, err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Fatalf("resolve took %v, want bounded by read timeout", d)
+	}
+}
+
+func TestSentinelClient_SwitchMasterWaitsForQuorum(t *testing.T) {
+	old := newFakeServer(t, fakeRedis("master"))
+	defer old.close()
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	// 每个sentinel报告的master地址可以单独修改
+	var addrs [3]atomic.Value
+	hosts := make([]string, len(addrs))
+	for i := range addrs {
+		addrs[i].Store(old.addr())
+		i := i
+		srv := newFakeServer(t, func(args []string) interface{} {
+			return fakeSentinel("mymaster", addrs[i].Load().(string))(args)
+		})
+		defer srv.close()
+		hosts[i] = srv.addr()
+	}
+
+	s := newTestClient("mymaster", old.addr(), SentinelHosts(hosts), MasterQuorum(2), DialTimeout(time.Second))
+	defer s.Close(context.Background())
+	s.addSentinelHosts(hosts...)
+	events, cancel := s.SubscribeFailover(4)
+	defer cancel()
+
+	oldHost, oldPort, _ := net.SplitHostPort(old.addr())
+	newHost, newPort, _ := net.SplitHostPort(m.addr())
+	data := strings.Join([]string{"mymaster", oldHost, oldPort, newHost, newPort}, " ")
+
+	// 第二个sentinel稍后才同步到新master, 等到quorum后切换, 不上报拒绝
+	addrs[0].Store(m.addr())
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		addrs[1].Store(m.addr())
+	}()
+	s.switchMaster(data)
+	if e := <-events; e.Err != nil || e.NewAddr != m.addr() {
+		t.Fatalf("event = %v, want switched after quorum caught up", e)
+	}
+
+	// 一直达不到quorum时等dialTimeout后拒绝
+	s.options.dialTimeout = 200 * time.Millisecond
+	start := time.Now()
+	s.switchMaster(strings.Join([]string{"mymaster", newHost, newPort, oldHost, oldPort}, " "))
+	e := <-events
+	if _, ok := e.Err.(*QuorumError); !ok || s.groups["mymaster"].getMasterHost() != m.addr() {
+		t.Fatalf("event = %v, want refused by quorum", e)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond || d >= time.Second {
+		t.Fatalf("refused after %v, want after waiting about dialTimeout", d)
+	}
+}
@@ -0,0 +1,459 @@
+package sentinelClient
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Balancer slave负载均衡策略
+type Balancer interface {
+	// Pick 从可用slave中选出一个, 返回下标, replicas不为空
+	Pick(replicas []ReplicaState) int
+}
+
+// ReplicaState 负载均衡时slave的状态
+type ReplicaState struct {
+	Host        string        // slave host
+	Outstanding int64         // 已借出未归还的连接数
+	Latency     time.Duration // 最近一次探测的ping耗时
+	LagOffset   int64         // 落后master的复制偏移量, 未知为-1
+	LagSeconds  int64         // 距上次和master通讯的秒数, 未知为-1
+}
+
+// lagLimit 复制延迟上限, <=0表示不限制
+type lagLimit struct {
+	offset  int64 // 最大落后偏移量
+	seconds int64 // 最大未通讯秒数
+}
+
+// lagLimit 配置的复制延迟上限
+func (s *sentinelClient) lagLimit() lagLimit {
+	return lagLimit{offset: s.options.maxSlaveLagOffset, seconds: int64(s.options.maxSlaveLag / time.Second)}
+}
+
+// exceeded 复制延迟是否超过上限, 配置了上限而延迟未知(取不到master或slave偏移量)时按超过处理
+func (l lagLimit) exceeded(r ReplicaState) bool {
+	if l.offset > 0 && (r.LagOffset < 0 || r.LagOffset > l.offset) {
+		return true
+	}
+	if l.seconds > 0 && (r.LagSeconds < 0 || r.LagSeconds > l.seconds) {
+		return true
+	}
+	return false
+}
+
+// RoundRobinBalancer 轮询
+func RoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+type roundRobinBalancer struct {
+	next uint64
+}
+
+func (b *roundRobinBalancer) Pick(replicas []ReplicaState) int {
+	n := atomic.AddUint64(&b.next, 1)
+	return int((n - 1) % uint64(len(replicas)))
+}
+
+// LeastOutstandingBalancer 选借出连接最少的slave, 相同时选延迟低的
+func LeastOutstandingBalancer() Balancer {
+	return leastOutstandingBalancer{}
+}
+
+type leastOutstandingBalancer struct{}
+
+func (leastOutstandingBalancer) Pick(replicas []ReplicaState) int {
+	best := 0
+	for i := 1; i < len(replicas); i++ {
+		r, b := replicas[i], replicas[best]
+		if r.Outstanding < b.Outstanding || (r.Outstanding == b.Outstanding && r.Latency < b.Latency) {
+			best = i
+		}
+	}
+	return best
+}
+
+// LatencyWeightedBalancer 按延迟加权随机, 延迟越低被选中概率越大
+func LatencyWeightedBalancer() Balancer {
+	return latencyWeightedBalancer{}
+}
+
+type latencyWeightedBalancer struct{}
+
+func (latencyWeightedBalancer) Pick(replicas []ReplicaState) int {
+	weights := make([]float64, len(replicas))
+	var total float64
+	for i, r := range replicas {
+		latency := r.Latency
+		if latency < time.Millisecond/10 {
+			latency = time.Millisecond / 10
+		}
+		weights[i] = 1 / float64(latency)
+		total += weights[i]
+	}
+
+	n := rand.Float64() * total
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(replicas) - 1
+}
+
+// ReplicaInfo SENTINEL slaves返回的slave信息
+type ReplicaInfo struct {
+	Name                string   // ip:port
+	IP                  string   // ip
+	Port                string   // port
+	RunID               string   // run id
+	Flags               []string // sentinel标记, 如slave,s_down,o_down,disconnected
+	RoleReported        string   // 实例上报的角色
+	MasterLinkStatus    string   // 和master的复制连接状态, ok/err
+	MasterLinkDownTime  int64    // 复制连接断开时长, 毫秒
+	MasterLastIOSeconds int64    // 距上次和master通讯的秒数, 未知为-1
+	SlavePriority       int64    // slave优先级, 0表示不参与选主也不参与读
+	SlaveReplOffset     int64    // 复制偏移量
+}
+
+// parseReplicaInfo 解析SENTINEL slaves返回的单个slave信息
+func parseReplicaInfo(m map[string]string) ReplicaInfo {
+	info := ReplicaInfo{
+		Name:                m["name"],
+		IP:                  m["ip"],
+		Port:                m["port"],
+		RunID:               m["runid"],
+		RoleReported:        m["role-reported"],
+		MasterLinkStatus:    m["master-link-status"],
+		MasterLinkDownTime:  parseInt64(m["master-link-down-time"], 0),
+		MasterLastIOSeconds: parseInt64(m["master-last-io-seconds-ago"], -1),
+		SlavePriority:       parseInt64(m["slave-priority"], 100),
+		SlaveReplOffset:     parseInt64(m["slave-repl-offset"], 0),
+	}
+	if flags := m["flags"]; len(flags) > 0 {
+		info.Flags = strings.Split(flags, ",")
+	}
+	if len(info.Name) <= 0 && len(info.IP) > 0 {
+		info.Name = net.JoinHostPort(info.IP, info.Port)
+	}
+	return info
+}
+
+// HasFlag 是否有某个sentinel标记
+func (r ReplicaInfo) HasFlag(flag string) bool {
+	for _, f := range r.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Healthy 是否可以用于读
+func (r ReplicaInfo) Healthy() bool {
+	if r.HasFlag("s_down") || r.HasFlag("o_down") || r.HasFlag("disconnected") {
+		return false
+	}
+	if len(r.MasterLinkStatus) > 0 && !strings.EqualFold(r.MasterLinkStatus, "ok") {
+		return false
+	}
+	return r.SlavePriority != 0
+}
+
+func parseInt64(s string, def int64) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// replicaProbe 探测slave的结果
+type replicaProbe struct {
+	latency    time.Duration // ping耗时
+	lagOffset  int64         // 落后master的复制偏移量, 未知为-1
+	lagSeconds int64         // 距上次和master通讯的秒数, 未知为-1
+}
+
+// replica 一个slave实例
+type replica struct {
+	host        string      // slave host
+	pool        *redis.Pool // 连接池
+	outstanding int64       // 已借出未归还的连接数
+	latency     int64       // 最近一次探测的ping耗时, 纳秒
+	lagOffset   int64       // 落后master的复制偏移量
+	lagSeconds  int64       // 距上次和master通讯的秒数
+	down        int32       // sentinel报告下线, 下次刷新前不参与读
+	unreachable int32       // 定时探测失败, 探测恢复或下次刷新前不参与读
+}
+
+func (r *replica) state() ReplicaState {
+	return ReplicaState{
+		Host:        r.host,
+		Outstanding: atomic.LoadInt64(&r.outstanding),
+		Latency:     time.Duration(atomic.LoadInt64(&r.latency)),
+		LagOffset:   atomic.LoadInt64(&r.lagOffset),
+		LagSeconds:  atomic.LoadInt64(&r.lagSeconds),
+	}
+}
+
+func (r *replica) setProbe(p replicaProbe) {
+	r.setLag(p)
+	atomic.StoreInt32(&r.down, 0)
+}
+
+// setLag 只更新探测结果, 不清除sentinel的下线标记
+func (r *replica) setLag(p replicaProbe) {
+	atomic.StoreInt64(&r.latency, int64(p.latency))
+	atomic.StoreInt64(&r.lagOffset, p.lagOffset)
+	atomic.StoreInt64(&r.lagSeconds, p.lagSeconds)
+	atomic.StoreInt32(&r.unreachable, 0)
+}
+
+// available 没有被sentinel标记下线且最近一次探测成功
+func (r *replica) available() bool {
+	return atomic.LoadInt32(&r.down) == 0 && atomic.LoadInt32(&r.unreachable) == 0
+}
+
+// replicaSet 主从组内所有可用slave
+type replicaSet struct {
+	mutex    sync.RWMutex
+	replicas []*replica
+}
+
+// get 按负载均衡策略借出一个slave连接, 跳过复制延迟超限的slave, 没有可用slave时返回errNoSlave
+func (rs *replicaSet) get(ctx context.Context, b Balancer, limit lagLimit) (redis.Conn, error) {
+	r := rs.pick(b, limit)
+	if r == nil {
+		return nil, errNoSlave
+	}
+
+	atomic.AddInt64(&r.outstanding, 1)
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		atomic.AddInt64(&r.outstanding, -1)
+		return nil, err
+	}
+	return &replicaConn{Conn: conn, r: r}, nil
+}
+
+// pick 按负载均衡策略选出一个slave
+func (rs *replicaSet) pick(b Balancer, limit lagLimit) *replica {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	states := make([]ReplicaState, 0, len(rs.replicas))
+	candidates := make([]*replica, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		state := r.state()
+		if !r.available() || limit.exceeded(state) {
+			continue
+		}
+		states = append(states, state)
+		candidates = append(candidates, r)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	i := b.Pick(states)
+	if i < 0 || i >= len(candidates) {
+		i = 0
+	}
+	return candidates[i]
+}
+
+// update 用最新探测结果替换slave列表, 新slave建连接池, 下线的slave关闭连接池
+func (rs *replicaSet) update(probes map[string]replicaProbe, createPool func(string) *redis.Pool) (added, removed []string) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	replicas := make([]*replica, 0, len(probes))
+	kept := make(map[string]struct{}, len(rs.replicas))
+	for _, r := range rs.replicas {
+		probe, ok := probes[r.host]
+		if !ok {
+			r.pool.Close()
+			removed = append(removed, r.host)
+			continue
+		}
+		r.setProbe(probe)
+		replicas = append(replicas, r)
+		kept[r.host] = struct{}{}
+	}
+
+	for host, probe := range probes {
+		if _, ok := kept[host]; ok {
+			continue
+		}
+		r := &replica{host: host, pool: createPool(host)}
+		r.setProbe(probe)
+		replicas = append(replicas, r)
+		added = append(added, host)
+	}
+
+	rs.replicas = replicas
+	return added, removed
+}
+
+// setProbes 用定时探测结果更新在用的slave, 不增删slave, 返回本次探测失败的slave
+func (rs *replicaSet) setProbes(probes map[string]replicaProbe) (unreachable []string) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	for _, r := range rs.replicas {
+		if probe, ok := probes[r.host]; ok {
+			r.setLag(probe)
+		} else if atomic.CompareAndSwapInt32(&r.unreachable, 0, 1) {
+			unreachable = append(unreachable, r.host)
+		}
+	}
+	return unreachable
+}
+
+// hosts 在用的slave
+func (rs *replicaSet) hosts() []string {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	hosts := make([]string, len(rs.replicas))
+	for i, r := range rs.replicas {
+		hosts[i] = r.host
+	}
+	return hosts
+}
+
+// markDown 标记slave下线, slave不在列表中返回false
+func (rs *replicaSet) markDown(host string) bool {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	for _, r := range rs.replicas {
+		if r.host == host {
+			return atomic.CompareAndSwapInt32(&r.down, 0, 1)
+		}
+	}
+	return false
+}
+
+// states 当前所有slave状态
+func (rs *replicaSet) states() []ReplicaState {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	states := make([]ReplicaState, len(rs.replicas))
+	for i, r := range rs.replicas {
+		states[i] = r.state()
+	}
+	return states
+}
+
+// borrowed 所有slave借出未归还的连接数
+func (rs *replicaSet) borrowed() int {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	var n int
+	for _, r := range rs.replicas {
+		n += borrowed(r.pool)
+	}
+	return n
+}
+
+// close 关闭所有slave连接池
+func (rs *replicaSet) close() {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	for _, r := range rs.replicas {
+		r.pool.Close()
+	}
+	rs.replicas = nil
+}
+
+// replicaConn 归还连接时减少slave的借出计数
+type replicaConn struct {
+	redis.Conn
+	r      *replica
+	closed int32
+}
+
+func (c *replicaConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+}
+
+func (c *replicaConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *replicaConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt64(&c.r.outstanding, -1)
+	}
+	return c.Conn.Close()
+}
+
+// probeConns 探测slave用的长连接, 每个slave一个, 避免每次探测重新建连/TLS握手/AUTH
+type probeConns struct {
+	mutex sync.Mutex
+	conns map[string]redis.Conn
+}
+
+// take 取出host的探测连接独占使用, 没有时返回nil
+func (pc *probeConns) take(host string) redis.Conn {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	conn := pc.conns[host]
+	delete(pc.conns, host)
+	return conn
+}
+
+// put 探测成功后放回连接
+func (pc *probeConns) put(host string, conn redis.Conn) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if pc.conns == nil {
+		pc.conns = make(map[string]redis.Conn)
+	}
+	if old, ok := pc.conns[host]; ok {
+		old.Close()
+	}
+	pc.conns[host] = conn
+}
+
+// retain 关闭不在hosts中的slave的探测连接
+func (pc *probeConns) retain(hosts map[string]replicaProbe) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	for host, conn := range pc.conns {
+		if _, ok := hosts[host]; !ok {
+			conn.Close()
+			delete(pc.conns, host)
+		}
+	}
+}
+
+// close 关闭所有探测连接
+func (pc *probeConns) close() {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	for host, conn := range pc.conns {
+		conn.Close()
+		delete(pc.conns, host)
+	}
+}
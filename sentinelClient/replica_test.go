@@ -0,0 +1,190 @@
+package sentinelClient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestRoundRobinBalancer_Pick(t *testing.T) {
+	replicas := []ReplicaState{{Host: "a"}, {Host: "b"}, {Host: "c"}}
+	b := RoundRobinBalancer()
+	for i := 0; i < 6; i++ {
+		if got := b.Pick(replicas); got != i%3 {
+			t.Fatalf("pick %d got %d", i, got)
+		}
+	}
+}
+
+func TestLeastOutstandingBalancer_Pick(t *testing.T) {
+	replicas := []ReplicaState{
+		{Host: "a", Outstanding: 3, Latency: time.Millisecond},
+		{Host: "b", Outstanding: 1, Latency: 5 * time.Millisecond},
+		{Host: "c", Outstanding: 1, Latency: 2 * time.Millisecond},
+	}
+	if got := LeastOutstandingBalancer().Pick(replicas); got != 2 {
+		t.Fatalf("got %d, want 2", got)
+	}
+}
+
+func TestLatencyWeightedBalancer_Pick(t *testing.T) {
+	replicas := []ReplicaState{
+		{Host: "a", Latency: time.Millisecond},
+		{Host: "b", Latency: 100 * time.Millisecond},
+	}
+	b := LatencyWeightedBalancer()
+	var count [2]int
+	for i := 0; i < 1000; i++ {
+		count[b.Pick(replicas)]++
+	}
+	if count[0] <= count[1] {
+		t.Fatalf("low latency replica picked %d times, high latency %d times", count[0], count[1])
+	}
+}
+
+func TestReplicaInfo_Healthy(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[string]string
+		want bool
+	}{
+		{"ok", map[string]string{"name": "10.0.0.1:6379", "flags": "slave", "master-link-status": "ok", "slave-priority": "100"}, true},
+		{"s_down", map[string]string{"name": "10.0.0.1:6379", "flags": "s_down,slave", "master-link-status": "ok"}, false},
+		{"o_down", map[string]string{"name": "10.0.0.1:6379", "flags": "slave,o_down"}, false},
+		{"disconnected", map[string]string{"name": "10.0.0.1:6379", "flags": "slave,disconnected"}, false},
+		{"link err", map[string]string{"name": "10.0.0.1:6379", "flags": "slave", "master-link-status": "err"}, false},
+		{"priority 0", map[string]string{"name": "10.0.0.1:6379", "flags": "slave", "slave-priority": "0"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseReplicaInfo(tt.m).Healthy(); got != tt.want {
+				t.Errorf("Healthy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReplicaInfo(t *testing.T) {
+	info := parseReplicaInfo(map[string]string{
+		"ip":                         "10.0.0.2",
+		"port":                       "6380",
+		"flags":                      "slave",
+		"master-last-io-seconds-ago": "2",
+		"slave-repl-offset":          "1024",
+	})
+	if info.Name != "10.0.0.2:6380" {
+		t.Errorf("Name = %s", info.Name)
+	}
+	if info.MasterLastIOSeconds != 2 || info.SlaveReplOffset != 1024 || info.SlavePriority != 100 {
+		t.Errorf("info = %+v", info)
+	}
+}
+
+func TestReplicaSet_GetLagLimit(t *testing.T) {
+	var rs replicaSet
+	rs.update(map[string]replicaProbe{
+		"a": {latency: time.Millisecond, lagOffset: 5000, lagSeconds: 1},
+		"b": {latency: time.Millisecond, lagOffset: 10, lagSeconds: 1},
+		"c": {latency: time.Millisecond, lagOffset: -1, lagSeconds: 30},
+		"d": {latency: time.Millisecond, lagOffset: -1, lagSeconds: 1},
+		"e": {latency: time.Millisecond, lagOffset: 10, lagSeconds: -1},
+	}, func(string) *redis.Pool {
+		return &redis.Pool{Dial: func() (redis.Conn, error) { return nil, errors.New("no dial") }}
+	})
+
+	for i := 0; i < 10; i++ {
+		r := rs.pick(RoundRobinBalancer(), lagLimit{offset: 100, seconds: 10})
+		if r == nil {
+			t.Fatal("no replica")
+		}
+		if r.host != "b" {
+			t.Fatalf("got replica %s, want b", r.host)
+		}
+	}
+
+	// 延迟未知时按超限处理, 只限制未通讯时长时偏移量未知的d可用
+	picked := map[string]bool{}
+	b := RoundRobinBalancer()
+	for i := 0; i < 10; i++ {
+		picked[rs.pick(b, lagLimit{seconds: 10}).host] = true
+	}
+	if !picked["a"] || !picked["b"] || !picked["d"] || picked["c"] || picked["e"] {
+		t.Fatalf("picked %v, want a/b/d", picked)
+	}
+
+	if _, err := rs.get(context.Background(), RoundRobinBalancer(), lagLimit{offset: 1, seconds: 10}); err != errNoSlave {
+		t.Fatalf("err = %v, want errNoSlave when all replicas exceed lag limit", err)
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	info := parseInfo("# Replication\r\nrole:slave\r\nslave_repl_offset:4096\r\nmaster_last_io_seconds_ago:3\r\n")
+	if info["role"] != "slave" || info["slave_repl_offset"] != "4096" || info["master_last_io_seconds_ago"] != "3" {
+		t.Fatalf("info = %+v", info)
+	}
+}
+
+func TestReplicaConn_WithTimeout(t *testing.T) {
+	srv := newFakeServer(t, fakeRedis("slave"))
+	defer srv.close()
+
+	s := newTestClient("mymaster", srv.addr())
+	defer s.Close(context.Background())
+	g := s.groups["mymaster"]
+	g.slaves.update(map[string]replicaProbe{srv.addr(): {lagOffset: -1, lagSeconds: -1}}, s.createRedisPool)
+
+	conn, err := g.slaves.get(context.Background(), RoundRobinBalancer(), lagLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if reply, err := redis.DoWithTimeout(conn, time.Second, "PING"); err != nil || reply != "PONG" {
+		t.Fatalf("DoWithTimeout reply = %v, err = %v", reply, err)
+	}
+	conn.Send("PING")
+	conn.Flush()
+	if reply, err := redis.ReceiveWithTimeout(conn, time.Second); err != nil || reply != "PONG" {
+		t.Fatalf("ReceiveWithTimeout reply = %v, err = %v", reply, err)
+	}
+}
+
+func TestSentinelClient_ProbeReplicas(t *testing.T) {
+	var fail int32
+	srv := newFakeServer(t, func(args []string) interface{} {
+		if atomic.LoadInt32(&fail) == 1 {
+			return errCloseConn
+		}
+		return fakeRedis("slave")(args)
+	})
+	defer srv.close()
+
+	s := newTestClient("mymaster", srv.addr())
+	defer s.Close(context.Background())
+	g := s.groups["mymaster"]
+	g.slaves.update(map[string]replicaProbe{srv.addr(): {lagOffset: -1, lagSeconds: -1}}, s.createRedisPool)
+
+	// 多次探测复用同一个连接
+	for i := 0; i < 3; i++ {
+		s.probeReplicas(g)
+	}
+	if n := srv.accepted(); n != 1 {
+		t.Fatalf("probe dialed %d times, want 1", n)
+	}
+
+	// 探测失败的slave不参与读, 恢复后重新参与
+	atomic.StoreInt32(&fail, 1)
+	s.probeReplicas(g)
+	if r := g.slaves.pick(RoundRobinBalancer(), lagLimit{}); r != nil {
+		t.Fatalf("picked unreachable slave %s", r.host)
+	}
+	atomic.StoreInt32(&fail, 0)
+	s.probeReplicas(g)
+	if r := g.slaves.pick(RoundRobinBalancer(), lagLimit{}); r == nil {
+		t.Fatal("slave not available after probe recovered")
+	}
+}
@@ -0,0 +1,131 @@
+package sentinelClient
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RetryPolicy Do的重试策略
+type RetryPolicy struct {
+	MaxRetries int           // 最大重试次数, <=0不重试
+	MinBackoff time.Duration // 第一次重试前最长等待, 之后每次翻倍, 新master就绪时提前重试
+	MaxBackoff time.Duration // 最长等待
+	// Idempotent 判断命令是否幂等, 连接断开时只重试幂等命令, nil使用内置命令表
+	Idempotent func(cmd string, args []interface{}) bool
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 50 * time.Millisecond,
+	MaxBackoff: time.Second,
+}
+
+// backoff 第attempt次重试前的等待时长
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 0; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+func (p RetryPolicy) idempotent(cmd string, args []interface{}) bool {
+	if p.Idempotent != nil {
+		return p.Idempotent(cmd, args)
+	}
+	return isIdempotent(cmd, args)
+}
+
+// errorKind 命令错误分类
+type errorKind int
+
+const (
+	errKindNone       errorKind = iota // 没有错误或不需要重试的错误
+	errKindReadOnly                    // 连到了slave, 主从切换中
+	errKindLoading                     // 实例正在加载数据
+	errKindMasterDown                  // slave和master断开
+	errKindConn                        // 连接断开/超时
+	errKindPoolClosed                  // 等待的连接池被替换, 命令未发出
+)
+
+// classifyError 错误分类, READONLY/LOADING/MASTERDOWN是命令被拒绝, 连接错误时命令可能已执行
+func classifyError(err error) errorKind {
+	switch err {
+	case nil, context.Canceled, context.DeadlineExceeded:
+		return errKindNone
+	case errNotMaster:
+		// 新建master连接时发现已降级, 和READONLY一样等新master
+		return errKindReadOnly
+	case errMasterDown:
+		return errKindMasterDown
+	}
+
+	// 主从切换或slave移除时关闭旧连接池, 等待中的借用返回该错误, 重试会用新连接池
+	if isPoolClosedError(err) {
+		return errKindPoolClosed
+	}
+
+	if e, ok := err.(redis.Error); ok {
+		switch {
+		case strings.HasPrefix(string(e), "READONLY"):
+			return errKindReadOnly
+		case strings.HasPrefix(string(e), "LOADING"):
+			return errKindLoading
+		case strings.HasPrefix(string(e), "MASTERDOWN"):
+			return errKindMasterDown
+		}
+		return errKindNone
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errKindConn
+	}
+	if _, ok := err.(net.Error); ok {
+		return errKindConn
+	}
+	msg := err.Error()
+	for _, s := range []string{"connection reset", "broken pipe", "use of closed network connection", "connection refused"} {
+		if strings.Contains(msg, s) {
+			return errKindConn
+		}
+	}
+	return errKindNone
+}
+
+// idempotentCommands 内置的幂等写命令, 只读命令都是幂等的, 见readOnlyCommands
+var idempotentCommands = map[string]bool{
+	"PING": true, "ECHO": true, "SET": true, "SETEX": true, "PSETEX": true, "MSET": true,
+	"DEL": true, "UNLINK": true, "HSET": true, "HMSET": true, "HDEL": true, "SADD": true,
+	"SREM": true, "ZREM": true, "EXPIRE": true, "PEXPIRE": true, "EXPIREAT": true,
+	"PEXPIREAT": true, "PERSIST": true, "SETBIT": true,
+}
+
+// isIdempotent 内置幂等判断, SET带NX/XX/GET时结果依赖执行前的值, 不算幂等
+func isIdempotent(cmd string, args []interface{}) bool {
+	cmd = strings.ToUpper(cmd)
+	if readOnlyCommands[cmd] {
+		return true
+	}
+	if !idempotentCommands[cmd] {
+		return false
+	}
+	if cmd == "SET" && len(args) > 2 {
+		for _, arg := range args[2:] {
+			if s, ok := arg.(string); ok {
+				switch strings.ToUpper(s) {
+				case "NX", "XX", "GET":
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+package sentinelClient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want errorKind
+	}{
+		{nil, errKindNone},
+		{context.DeadlineExceeded, errKindNone},
+		{redis.Error("READONLY You can't write against a read only replica."), errKindReadOnly},
+		{errNotMaster, errKindReadOnly},
+		{redis.Error("LOADING Redis is loading the dataset in memory"), errKindLoading},
+		{redis.Error("MASTERDOWN Link with MASTER is down"), errKindMasterDown},
+		{redis.Error("ERR unknown command"), errKindNone},
+		{io.EOF, errKindConn},
+		{errors.New("read tcp 127.0.0.1:1->127.0.0.1:2: read: connection reset by peer"), errKindConn},
+		{errors.New("redigo: get on closed pool"), errKindPoolClosed},
+		{errors.New("something else"), errKindNone},
+	}
+	for _, c := range cases {
+		if got := classifyError(c.err); got != c.want {
+			t.Errorf("classifyError(%v) = %d, want %d", c.err, got, c.want)
+		}
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		args []interface{}
+		want bool
+	}{
+		{"get", []interface{}{"k"}, true},
+		{"SET", []interface{}{"k", "v"}, true},
+		{"SET", []interface{}{"k", "v", "EX", 10}, true},
+		{"SET", []interface{}{"k", "v", "nx"}, false},
+		{"INCR", []interface{}{"k"}, false},
+		{"LPUSH", []interface{}{"k", "v"}, false},
+	}
+	for _, c := range cases {
+		if got := isIdempotent(c.cmd, c.args); got != c.want {
+			t.Errorf("isIdempotent(%s %v) = %v, want %v", c.cmd, c.args, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 35 * time.Millisecond}
+	for attempt, want := range []time.Duration{10, 20, 35, 35} {
+		if got := p.backoff(attempt); got != want*time.Millisecond {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want*time.Millisecond)
+		}
+	}
+}
+
+func TestSentinelClient_DoRetryAcrossFailover(t *testing.T) {
+	old := newFakeServer(t, fakeRedis("slave"))
+	defer old.close()
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", old.addr(), Retry(RetryPolicy{MaxRetries: 3, MinBackoff: time.Second, MaxBackoff: time.Second}))
+	defer s.Close(context.Background())
+
+	// 旧master已降为slave, 切换到新master后不用等退避立即重试
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.changeMaster(s.groups["mymaster"], m.addr())
+	}()
+
+	start := time.Now()
+	reply, err := s.Do(context.Background(), "mymaster", "SET", "k", "v")
+	if err != nil || reply != "OK" {
+		t.Fatalf("reply = %v, err = %v", reply, err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Fatalf("retry waited %v, want woken by master switch", d)
+	}
+}
+
+func TestSentinelClient_DoRetryLimit(t *testing.T) {
+	var incr, get int32
+	srv := newFakeServer(t, func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "ROLE", "PING":
+			return fakeRedis("master")(args)
+		case "INCR":
+			atomic.AddInt32(&incr, 1)
+			return errCloseConn
+		case "GET":
+			atomic.AddInt32(&get, 1)
+			return redis.Error("LOADING Redis is loading the dataset in memory")
+		}
+		return errors.New("ERR unknown command")
+	})
+	defer srv.close()
+
+	s := newTestClient("mymaster", srv.addr(), Retry(RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond}))
+	defer s.Close(context.Background())
+
+	// 连接断开时非幂等命令不重试
+	if _, err := s.Do(context.Background(), "mymaster", "INCR", "k"); classifyError(err) != errKindConn {
+		t.Fatalf("err = %v, want connection error", err)
+	}
+	if n := atomic.LoadInt32(&incr); n != 1 {
+		t.Fatalf("INCR sent %d times, want 1", n)
+	}
+
+	// 命令被拒绝时重试到上限
+	if _, err := s.Do(context.Background(), "mymaster", "GET", "k"); classifyError(err) != errKindLoading {
+		t.Fatalf("err = %v, want LOADING", err)
+	}
+	if n := atomic.LoadInt32(&get); n != 3 {
+		t.Fatalf("GET sent %d times, want 3", n)
+	}
+}
+
+func TestSentinelClient_DoMasterDown(t *testing.T) {
+	var sets int32
+	countSet := func(args []string) interface{} {
+		if strings.EqualFold(args[0], "SET") {
+			atomic.AddInt32(&sets, 1)
+		}
+		return fakeRedis("master")(args)
+	}
+	old := newFakeServer(t, countSet)
+	defer old.close()
+	m := newFakeServer(t, countSet)
+	defer m.close()
+
+	s := newTestClient("mymaster", old.addr(), Retry(RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond}))
+	defer s.Close(context.Background())
+	g := s.groups["mymaster"]
+
+	// master下线期间写命令不发出, 重试到上限返回errMasterDown
+	s.handleSentinelEvent("+odown", "master mymaster 127.0.0.1 6379 #quorum 2/2")
+	if _, err := s.Do(context.Background(), "mymaster", "SET", "k", "v"); err != errMasterDown {
+		t.Fatalf("err = %v, want errMasterDown", err)
+	}
+	if n := atomic.LoadInt32(&sets); n != 0 {
+		t.Fatalf("SET sent %d times while master down", n)
+	}
+
+	// 切换中止后继续使用原master
+	s.handleSentinelEvent("-failover-abort-not-elected", "master mymaster 127.0.0.1 6379")
+	if _, err := s.Do(context.Background(), "mymaster", "SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 切换到新master时唤醒等待的写命令
+	s.options.retryPolicy = RetryPolicy{MaxRetries: 3, MinBackoff: time.Second, MaxBackoff: time.Second}
+	s.handleSentinelEvent("+try-failover", "master mymaster 127.0.0.1 6379")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.changeMaster(g, m.addr())
+	}()
+	start := time.Now()
+	if _, err := s.Do(context.Background(), "mymaster", "SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Fatalf("waited %v, want woken by master switch", d)
+	}
+	if g.isMasterDown() {
+		t.Fatal("master down not cleared after switch")
+	}
+}
+
+func TestSentinelClient_DoPoolClosedWhileWaiting(t *testing.T) {
+	m := newFakeServer(t, func(args []string) interface{} {
+		if strings.EqualFold(args[0], "GET") {
+			return "master"
+		}
+		return fakeRedis("master")(args)
+	})
+	defer m.close()
+	r := newFakeServer(t, fakeRedis("slave"))
+	defer r.close()
+
+	s := newTestClient("mymaster", m.addr(), MaxActive(1), Retry(RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond}))
+	defer s.Close(context.Background())
+	g := s.groups["mymaster"]
+	g.slaves.update(map[string]replicaProbe{r.addr(): {lagOffset: -1, lagSeconds: -1}}, s.createRedisPool)
+
+	// 占满slave连接池, 让GET等待
+	held, err := s.GetSlaverClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		reply, err := redis.String(s.Do(context.Background(), "mymaster", "GET", "k"))
+		if err == nil && reply != "master" {
+			err = errors.New("reply " + reply)
+		}
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// slave被移除时等待中的GET没有发出, 重试后读master
+	g.slaves.update(nil, s.createRedisPool)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("err = %v, want retried on master", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GET still waiting on removed slave pool")
+	}
+}
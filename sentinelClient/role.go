@@ -0,0 +1,199 @@
+package sentinelClient
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+const (
+	verifyMasterRetry    = 3           // 校验master角色失败时重新获取master的次数
+	verifyMasterInterval = time.Second // 重新获取master的间隔
+)
+
+// getRole 获取redis实例角色, master/slave/sentinel
+func getRole(conn redis.Conn) (string, error) {
+	resp, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return "", err
+	}
+	if len(resp) == 0 {
+		return "", errGetInfoBySentinel
+	}
+	return redis.String(resp[0], nil)
+}
+
+// checkMasterRole 校验连接的实例是master
+func checkMasterRole(conn redis.Conn) error {
+	role, err := getRole(conn)
+	if err != nil {
+		return err
+	}
+	if role != "master" {
+		return errNotMaster
+	}
+	return nil
+}
+
+// verifyMasterRole 连接host校验是master
+// 在sentinel事件goroutine中同步执行, 设置超时避免连不上的新master卡住事件处理
+func (s *sentinelClient) verifyMasterRole(host string) error {
+	conn, err := s.dialRedis(
+		host,
+		redis.DialConnectTimeout(s.options.dialConnTimeout),
+		redis.DialReadTimeout(s.options.dialTimeout),
+		redis.DialWriteTimeout(s.options.dialTimeout),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return checkMasterRole(conn)
+}
+
+// resolveVerifiedMaster 获取master地址并校验ROLE, 不是master时重新获取
+func (s *sentinelClient) resolveVerifiedMaster(g *masterGroup, sentinelHost string) (string, error) {
+	var (
+		host string
+		err  error
+	)
+	for i := 0; i < verifyMasterRetry; i++ {
+		if i > 0 {
+			time.Sleep(verifyMasterInterval)
+		}
+
+		if host, err = s.resolveMaster(g, sentinelHost); err != nil {
+			continue
+		}
+		if err = s.verifyMasterRole(host); err == nil {
+			return host, nil
+		}
+		s.options.logger.Warn("verify master role err", logger.F("master", g.name), logger.F("host", host), logger.Err(err))
+	}
+	return "", err
+}
+
+// reResolveMaster 异步重新获取master, 地址变化时切换连接池, 同一主从组同时只有一个在执行
+func (s *sentinelClient) reResolveMaster(g *masterGroup) {
+	if !atomic.CompareAndSwapInt32(&g.resolving, 0, 1) {
+		return
+	}
+
+	s.goroutine(func() {
+		defer atomic.StoreInt32(&g.resolving, 0)
+
+		sentinelHost, err := s.switchQuicklyHost(s.getSentinelHosts())
+		if err != nil {
+			s.options.logger.Error("switch quickly host err", logger.Err(err))
+			s.setLastError(err)
+			return
+		}
+
+		host, err := s.resolveVerifiedMaster(g, sentinelHost)
+		if err != nil {
+			s.options.logger.Error("re-resolve master err", logger.F("master", g.name), logger.Err(err))
+			s.setLastError(err)
+			return
+		}
+
+		s.changeMaster(g, host)
+	})
+}
+
+// changeMaster master地址变化时切换连接池并通知
+func (s *sentinelClient) changeMaster(g *masterGroup, host string) {
+	oldHost := g.getMasterHost()
+	if host == oldHost {
+		return
+	}
+
+	s.swapMasterPool(g, host)
+	s.notifyFailover(FailoverEvent{
+		MasterName: g.name,
+		OldAddr:    oldHost,
+		NewAddr:    host,
+		Time:       time.Now(),
+		Epoch:      -1,
+	})
+}
+
+// createMasterRedisPool master连接池, 新建连接和空闲检查时校验ROLE, 不是master时重新获取master
+func (s *sentinelClient) createMasterRedisPool(g *masterGroup, host string) *redis.Pool {
+	pool := s.createRedisPool(host)
+
+	dial := pool.Dial
+	pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		if err != nil {
+			return nil, err
+		}
+		if err = checkMasterRole(c); err != nil {
+			c.Close()
+			if err == errNotMaster {
+				s.reResolveMaster(g)
+			}
+			return nil, err
+		}
+		return c, nil
+	}
+
+	pool.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+		if time.Since(t) < s.options.idleCheckTime {
+			return nil
+		}
+		err := checkMasterRole(c)
+		if err == errNotMaster {
+			s.reResolveMaster(g)
+		}
+		return err
+	}
+
+	return pool
+}
+
+// masterConn master连接, 遇到READONLY说明master已降级, 触发重新获取master
+type masterConn struct {
+	redis.Conn
+	s *sentinelClient
+	g *masterGroup
+}
+
+func (c *masterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	c.checkErr(err)
+	return reply, err
+}
+
+func (c *masterConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	c.checkErr(err)
+	return reply, err
+}
+
+func (c *masterConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	c.checkErr(err)
+	return reply, err
+}
+
+func (c *masterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	c.checkErr(err)
+	return reply, err
+}
+
+func (c *masterConn) checkErr(err error) {
+	if isReadOnlyError(err) {
+		c.s.options.logger.Warn("master readonly", logger.F("master", c.g.name), logger.F("host", c.g.getMasterHost()))
+		c.s.reResolveMaster(c.g)
+	}
+}
+
+func isReadOnlyError(err error) bool {
+	e, ok := err.(redis.Error)
+	return ok && strings.HasPrefix(string(e), "READONLY")
+}
@@ -0,0 +1,100 @@
+package sentinelClient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestSentinelClient_VerifyMasterRole(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	r := newFakeServer(t, fakeRedis("slave"))
+	defer m.close()
+	defer r.close()
+
+	s := &sentinelClient{options: defaultOptions}
+	if err := s.verifyMasterRole(m.addr()); err != nil {
+		t.Fatalf("master err = %v", err)
+	}
+	if err := s.verifyMasterRole(r.addr()); err != errNotMaster {
+		t.Fatalf("slave err = %v, want errNotMaster", err)
+	}
+
+	// 不回复ROLE时按读超时返回
+	hang := make(chan struct{})
+	h := newFakeServer(t, func(args []string) interface{} {
+		<-hang
+		return errCloseConn
+	})
+	defer h.close()
+	defer close(hang)
+
+	s.options.dialTimeout = 50 * time.Millisecond
+	start := time.Now()
+	if err := s.verifyMasterRole(h.addr()); classifyError(err) != errKindConn {
+		t.Fatalf("hung err = %v, want timeout", err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Fatalf("verify took %v, want bounded by read timeout", d)
+	}
+}
+
+func TestIsReadOnlyError(t *testing.T) {
+	r := newFakeServer(t, fakeRedis("slave"))
+	defer r.close()
+
+	conn, err := redis.Dial("tcp", r.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("SET", "k", "v")
+	if !isReadOnlyError(err) {
+		t.Fatalf("err = %v, want READONLY", err)
+	}
+	if isReadOnlyError(errNotMaster) {
+		t.Fatal("errNotMaster is not READONLY")
+	}
+}
+
+func TestMasterConn_WithTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	m := newFakeServer(t, func(args []string) interface{} {
+		if args[0] == "HANG" {
+			<-hang
+		}
+		return fakeRedis("master")(args)
+	})
+	defer m.close()
+	defer close(hang)
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+
+	conn, err := s.getMasterConn(context.Background(), s.groups["mymaster"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if reply, err := redis.DoWithTimeout(conn, time.Second, "PING"); err != nil || reply != "PONG" {
+		t.Fatalf("DoWithTimeout reply = %v, err = %v", reply, err)
+	}
+	conn.Send("PING")
+	conn.Flush()
+	if reply, err := redis.ReceiveWithTimeout(conn, time.Second); err != nil || reply != "PONG" {
+		t.Fatalf("ReceiveWithTimeout reply = %v, err = %v", reply, err)
+	}
+
+	// 按调用方的超时返回, 不受连接默认读超时影响
+	start := time.Now()
+	if _, err = redis.DoWithTimeout(conn, 50*time.Millisecond, "HANG"); classifyError(err) != errKindConn {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Fatalf("DoWithTimeout took %v", d)
+	}
+}
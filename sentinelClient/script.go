@@ -0,0 +1,114 @@
+package sentinelClient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// scriptRegistry 注册的lua脚本, 新master的脚本缓存是空的, 切换后需要重新加载
+type scriptRegistry struct {
+	mutex   sync.RWMutex
+	scripts map[string]*redis.Script // sha1 -> 脚本
+}
+
+// add 注册脚本, 已注册过返回false
+func (r *scriptRegistry) add(script *redis.Script) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.scripts == nil {
+		r.scripts = make(map[string]*redis.Script)
+	}
+	if _, ok := r.scripts[script.Hash()]; ok {
+		return false
+	}
+	r.scripts[script.Hash()] = script
+	return true
+}
+
+func (r *scriptRegistry) list() []*redis.Script {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	scripts := make([]*redis.Script, 0, len(r.scripts))
+	for _, script := range r.scripts {
+		scripts = append(scripts, script)
+	}
+	return scripts
+}
+
+// RegisterScript 注册lua脚本并加载到所有master, 主从切换后自动加载到新master
+// 加载失败时脚本仍然注册, 执行时NOSCRIPT会用EVAL执行
+func (s *sentinelClient) RegisterScript(script *redis.Script) error {
+	s.scripts.add(script)
+
+	var firstErr error
+	for _, g := range s.groups {
+		if err := s.loadScripts(g, script); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// EvalScript 在master上用EVALSHA执行脚本, NOSCRIPT时用EVAL执行并缓存脚本
+// 没注册过的脚本自动注册, 遇到READONLY等主从切换错误时按重试策略重试, 连接断开时不重试
+func (s *sentinelClient) EvalScript(ctx context.Context, masterName string, script *redis.Script, keysAndArgs ...interface{}) (interface{}, error) {
+	if s.isClosed() {
+		return nil, errClosed
+	}
+
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.scripts.add(script)
+	return s.retry(ctx, g, false, false, "EVALSHA", func(conn redis.Conn) (interface{}, error) {
+		return script.Do(conn, keysAndArgs...)
+	})
+}
+
+// loadScripts 把脚本加载到主从组当前的master, 不传scripts时加载所有注册的脚本
+func (s *sentinelClient) loadScripts(g *masterGroup, scripts ...*redis.Script) error {
+	if len(scripts) == 0 {
+		scripts = s.scripts.list()
+	}
+	if len(scripts) == 0 {
+		return nil
+	}
+
+	ctx, cancel := s.borrowContext()
+	defer cancel()
+
+	conn, err := s.getMasterConn(ctx, g)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, script := range scripts {
+		if err = script.Load(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reloadScripts master切换后后台加载所有注册的脚本
+func (s *sentinelClient) reloadScripts(g *masterGroup) {
+	if len(s.scripts.list()) == 0 {
+		return
+	}
+
+	s.goroutine(func() {
+		if err := s.loadScripts(g); err != nil {
+			s.options.logger.Warn("reload scripts err", logger.F("master", g.name), logger.F("host", g.getMasterHost()), logger.Err(err))
+			return
+		}
+		s.options.logger.Info("scripts reloaded", logger.F("master", g.name), logger.F("host", g.getMasterHost()))
+	})
+}
@@ -0,0 +1,105 @@
+package sentinelClient
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// fakeScriptRedis 带脚本缓存的master, 脚本执行结果固定为"ok"
+type fakeScriptRedis struct {
+	mutex   sync.Mutex
+	scripts map[string]string
+	evals   int
+}
+
+func (r *fakeScriptRedis) loaded(hash string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.scripts[hash]
+	return ok
+}
+
+func (r *fakeScriptRedis) evalCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.evals
+}
+
+func (r *fakeScriptRedis) handle(args []string) interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.scripts == nil {
+		r.scripts = map[string]string{}
+	}
+	switch strings.ToUpper(args[0]) {
+	case "SCRIPT":
+		sum := sha1.Sum([]byte(args[2]))
+		hash := hex.EncodeToString(sum[:])
+		r.scripts[hash] = args[2]
+		return []byte(hash)
+	case "EVALSHA":
+		if _, ok := r.scripts[args[1]]; !ok {
+			return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return "ok"
+	case "EVAL":
+		r.evals++
+		sum := sha1.Sum([]byte(args[1]))
+		r.scripts[hex.EncodeToString(sum[:])] = args[1]
+		return "ok"
+	}
+	return fakeRedis("master")(args)
+}
+
+func TestSentinelClient_Script(t *testing.T) {
+	r1, r2 := &fakeScriptRedis{}, &fakeScriptRedis{}
+	m1 := newFakeServer(t, r1.handle)
+	defer m1.close()
+	m2 := newFakeServer(t, r2.handle)
+	defer m2.close()
+
+	s := newTestClient("mymaster", m1.addr())
+	defer s.Close(context.Background())
+
+	script := redis.NewScript(1, "return redis.call('GET', KEYS[1])")
+	if err := s.RegisterScript(script); err != nil {
+		t.Fatal(err)
+	}
+	if !r1.loaded(script.Hash()) {
+		t.Fatal("script not loaded on master")
+	}
+
+	// 切换后后台加载到新master
+	s.changeMaster(s.groups["mymaster"], m2.addr())
+	deadline := time.Now().Add(time.Second)
+	for !r2.loaded(script.Hash()) {
+		if time.Now().After(deadline) {
+			t.Fatal("script not reloaded on new master")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	reply, err := redis.String(s.EvalScript(context.Background(), "mymaster", script, "k"))
+	if err != nil || reply != "ok" || r2.evalCount() != 0 {
+		t.Fatalf("reply = %v, err = %v, evals = %d, want EVALSHA hit", reply, err, r2.evalCount())
+	}
+
+	// 没注册过且未加载的脚本NOSCRIPT时用EVAL执行
+	other := redis.NewScript(0, "return 1")
+	reply, err = redis.String(s.EvalScript(context.Background(), "mymaster", other))
+	if err != nil || reply != "ok" || r2.evalCount() != 1 {
+		t.Fatalf("reply = %v, err = %v, evals = %d, want EVAL fallback", reply, err, r2.evalCount())
+	}
+	if len(s.scripts.list()) != 2 {
+		t.Fatalf("registered = %d, want 2", len(s.scripts.list()))
+	}
+}
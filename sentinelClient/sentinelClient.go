@@ -1,50 +1,90 @@
 package sentinelClient
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"log"
-	"net"
-	"strings"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
 )
 
 type SentinelClient interface {
 	// 初始化
 	Init(...Option) error
-	// 关闭
-	Close()
-	// master连接池
-	GetMasterClient() redis.Conn
-	// slave连接池
-	GetSlaverClient() redis.Conn
+	// 关闭, 等待借出的连接在ctx截止前归还
+	Close(ctx context.Context) error
+	// master连接池, 连接池满时最多等待dialTimeout
+	GetMasterClient(masterName string) redis.Conn
+	// slave连接池, 连接池满时最多等待dialTimeout
+	GetSlaverClient(masterName string) redis.Conn
+	// master连接池, 连接池满时等待直到ctx超时或取消
+	GetMasterClientContext(ctx context.Context, masterName string) (redis.Conn, error)
+	// slave连接池, 连接池满时等待直到ctx超时或取消
+	GetSlaverClientContext(ctx context.Context, masterName string) (redis.Conn, error)
+	// 订阅主从切换事件, size为chan缓冲大小, 返回取消订阅函数
+	SubscribeFailover(size int) (<-chan FailoverEvent, func())
+	// 订阅sentinel所有事件, size为chan缓冲大小, 返回取消订阅函数
+	SubscribeSentinelEvent(size int) (<-chan SentinelEvent, func())
+	// 当前使用的sentinel host列表
+	SentinelHosts() []string
+	// sentinel报告的master当前config-epoch, 每次主从切换递增
+	ConfigEpoch(masterName string) (int64, error)
+	// 连接池/主从切换/订阅状态统计
+	Stats() Stats
+	// prometheus文本格式的指标
+	MetricsHandler() http.Handler
+	// 就绪检查和主从拓扑, 路径以/topology结尾时返回拓扑
+	HealthHandler() http.Handler
+	// 执行命令, 只读命令在slave上执行, 主从切换中出错时按重试策略等新master后重试
+	Do(ctx context.Context, masterName string, cmd string, args ...interface{}) (interface{}, error)
+	// 批量执行命令, 按读写分到master/slave分段流水线执行
+	ExecBatch(ctx context.Context, masterName string, b *Batch) ([]BatchResult, error)
+	// 在master上执行WATCH/MULTI/EXEC事务, WATCH的key被修改时重试
+	Tx(ctx context.Context, masterName string, watchKeys []string, fn func(tx *Tx) error) ([]interface{}, error)
+	// 注册lua脚本, 加载到所有master, 主从切换后自动加载到新master
+	RegisterScript(script *redis.Script) error
+	// 在master上执行lua脚本, NOSCRIPT时用EVAL执行
+	EvalScript(ctx context.Context, masterName string, script *redis.Script, keysAndArgs ...interface{}) (interface{}, error)
+	// 在master上订阅频道, 主从切换后自动重新订阅
+	NewSubscriber(masterName string, size int) (*Subscriber, error)
 }
 
 type Option func(*Options)
-type SwitchMasterHook func(string)
+type SwitchMasterHook func(FailoverEvent)
+type DrainHook func(DrainResult)
 
 // redisInfo redis实例信息
 type redisInfo struct {
-	host       string       // redis host
-	mutex      sync.RWMutex // 锁
-	conn       redis.Conn   // redis连接
-	status     int32        // redis实例状态
-	poolMutex  sync.RWMutex // 锁
-	poolClient *redis.Pool  // 连接池
+	host       string          // redis host
+	mutex      sync.RWMutex    // 锁
+	poolMutex  sync.RWMutex    // 锁
+	poolGen    *poolGeneration // 当前一代连接池
+	generation uint64          // 连接池代数, 每次切换加1
+	swapped    chan struct{}   // 切换连接池时关闭
 }
 
 // sentinelClient sentinel实例
 type sentinelClient struct {
-	options      Options          // 参数
-	stop         chan struct{}    // 关闭标记
-	pubSubConn   redis.PubSubConn // 订阅连接
-	pubSubStatus int32            // 订阅连接状态
-	pubSubMutex  sync.Mutex       // 锁
-	master       redisInfo        // redis主
-	slaver       redisInfo        // redis从
+	options       Options                 // 参数
+	stop          chan struct{}           // 关闭标记
+	pubSubConn    redis.PubSubConn        // 订阅连接
+	pubSubStatus  int32                   // 订阅连接状态
+	pubSubMutex   sync.Mutex              // 锁
+	sentinelHost  string                  // 当前订阅的sentinel
+	sentinelHosts []string                // sentinel host列表, 包括自动发现的
+	sentinelMutex sync.RWMutex            // 锁
+	groups        map[string]*masterGroup // master-name对应的主从组
+	events        eventBroker             // 主从切换/sentinel事件订阅
+	wg            sync.WaitGroup          // 后台goroutine
+	closed        bool                    // 是否已关闭
+	closeMutex    sync.RWMutex            // 锁
+	stats         clientStats             // 重连次数/最近错误统计
+	metrics       metrics                 // 命令/借连接指标
+	commands      commandTable            // 命令是否只读, 用于Do读写分离
+	scripts       scriptRegistry          // 注册的lua脚本
 }
 
 const (
@@ -56,6 +96,14 @@ var (
 	errOptions           = errors.New("sentinel error options")
 	errSwitchQuicklyHost = errors.New("can not get quickly host")
 	errGetInfoBySentinel = errors.New("can not get info by sentinel")
+	errUnknownMasterName = errors.New("unknown master name")
+	errEventFormat       = errors.New("sentinel event format error")
+	errNotMaster         = errors.New("redis instance is not master")
+	errNoSlave           = errors.New("no available slave")
+	errClosed            = errors.New("sentinel client closed")
+	errRole              = errors.New("redis role not right")
+	errPubSubDown        = errors.New("sentinel pubsub disconnected")
+	errMasterDown        = errors.New("master down, failover in progress")
 )
 
 func New() SentinelClient {
@@ -72,71 +120,207 @@ func (s *sentinelClient) Init(opts ...Option) (err error) {
 	if err = s.checkOptions(); err != nil {
 		return err
 	}
-	s.stop = make(chan struct{}, 1)
+	s.stop = make(chan struct{})
+	s.groups = make(map[string]*masterGroup, len(s.options.masterNames))
+	for _, name := range s.options.masterNames {
+		s.groups[name] = newMasterGroup(name)
+	}
+
+	s.addSentinelHosts(s.options.sentinelHosts...)
 
 	// 2.选出最优sentinel host
-	sentinelHost, err := s.switchQuicklyHost(s.options.sentinelHosts)
+	sentinelHost, err := s.switchQuicklyHost(s.getSentinelHosts())
 	if err != nil {
 		return err
 	}
 
-	// 3.连接sentinel, 获取master信息
+	// 3.连接sentinel, 所有主从组共用一个订阅
 	if err = s.connectRedis(sentinelHost); err != nil {
 		return err
 	}
 
-	// 4.初始化master连接池
-	if err = s.initRedisPool(sentinelHost, master, false); err != nil {
-		return err
+	for _, g := range s.groups {
+		// 4.初始化master连接池
+		if err = s.initRedisPool(g, sentinelHost, master, false); err != nil {
+			return err
+		}
+
+		// 5.初始化slave连接池
+		if err = s.initRedisPool(g, sentinelHost, slave, false); err != nil {
+			return err
+		}
 	}
 
-	// 5.初始化slave连接池
-	if err = s.initRedisPool(sentinelHost, slave, false); err != nil {
-		return err
+	// 6.获取命令表, 用于Do读写分离
+	// 所有主从组一般是同一版本的redis, 只取第一个
+	if err = s.initCommandTable(s.groups[s.options.masterNames[0]]); err != nil {
+		s.options.logger.Warn("load command table err, use builtin", logger.F("master", s.options.masterNames[0]), logger.Err(err))
+	}
+
+	// 7.发现配置之外的sentinel
+	if err = s.discoverSentinels(sentinelHost); err != nil {
+		s.options.logger.Warn("discover sentinel err", logger.F("sentinel", sentinelHost), logger.Err(err))
+	}
+
+	// 8.sentinel订阅监听主从切换
+	s.goroutine(s.subSentinelEvent)
+
+	// 9.定时检测pubSub和slaveConn的连接
+	s.goroutine(s.monitorRedisStatusLoop)
+
+	return nil
+}
+
+// GetMasterClient 从master连接池获取连接, 连接池满时最多等待dialTimeout
+func (s *sentinelClient) GetMasterClient(masterName string) redis.Conn {
+	ctx, cancel := s.borrowContext()
+	defer cancel()
+
+	conn, err := s.GetMasterClientContext(ctx, masterName)
+	if err != nil {
+		return errorConn{err}
+	}
+	return conn
+}
+
+// GetSlaverClient 按负载均衡策略从slave连接池获取连接, 没有可用slave或复制延迟都超限时使用master
+// 连接池满时最多等待dialTimeout
+func (s *sentinelClient) GetSlaverClient(masterName string) redis.Conn {
+	ctx, cancel := s.borrowContext()
+	defer cancel()
+
+	conn, err := s.GetSlaverClientContext(ctx, masterName)
+	if err != nil {
+		return errorConn{err}
+	}
+	return conn
+}
+
+// GetMasterClientContext 从master连接池获取连接, 连接池满时等待, ctx超时或取消时返回错误
+func (s *sentinelClient) GetMasterClientContext(ctx context.Context, masterName string) (redis.Conn, error) {
+	if s.isClosed() {
+		return nil, errClosed
 	}
 
-	// 6.sentinel订阅监听主从切换
-	go s.subSentinelEvent()
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return nil, err
+	}
 
-	// 7.定时检测pubSub和slaveConn的连接
-	go s.monitorRedisStatusLoop()
+	start := time.Now()
+	conn, err := s.getMasterConn(ctx, g)
+	return s.metrics.instrument(conn, err, metricKey{master: g.name, role: "master"}, start)
+}
 
-	return
+// GetSlaverClientContext 同GetSlaverClient, 连接池满时等待, ctx超时或取消时返回错误
+func (s *sentinelClient) GetSlaverClientContext(ctx context.Context, masterName string) (redis.Conn, error) {
+	if s.isClosed() {
+		return nil, errClosed
+	}
+
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	conn, err := g.slaves.get(ctx, s.options.balancer, s.lagLimit())
+	if err != errNoSlave {
+		return s.metrics.instrument(conn, err, metricKey{master: g.name, role: "slave"}, start)
+	}
+
+	conn, err = s.getMasterConn(ctx, g)
+	return s.metrics.instrument(conn, err, metricKey{master: g.name, role: "master"}, start)
 }
 
-// Close 关闭sentinelClient
-func (s *sentinelClient) Close() {
-	s.stop <- struct{}{}
+// borrowContext 不带ctx的接口和内部借连接用的ctx, 连接池满时最多等待dialTimeout
+// 避免业务占满连接池时卡住定时检测和Close, ctx只用于借连接, 借到的连接不受影响
+func (s *sentinelClient) borrowContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.options.dialTimeout)
 }
 
-// GetMasterClient 从master连接池获取连接
-func (s *sentinelClient) GetMasterClient() redis.Conn {
-	s.master.poolMutex.RLock()
-	defer s.master.poolMutex.RUnlock()
+// getMasterConn 从主从组的master连接池获取连接
+func (s *sentinelClient) getMasterConn(ctx context.Context, g *masterGroup) (redis.Conn, error) {
+	for {
+		// 等待连接时不持有锁, 避免阻塞主从切换
+		gen := g.currentPoolGen()
+		conn, err := gen.pool.GetContext(ctx)
+		if err == nil {
+			return &masterConn{Conn: conn, s: s, g: g}, nil
+		}
 
-	return s.master.poolClient.Get()
+		// 借连接前或等待连接时这一代被切换下线, 到新的一代借
+		if isPoolClosedError(err) && g.currentPoolGen() != gen {
+			continue
+		}
+		return nil, err
+	}
 }
 
-// GetSlaverClient 从slave连接池获取连接
-func (s *sentinelClient) GetSlaverClient() redis.Conn {
-	s.slaver.poolMutex.RLock()
-	defer s.slaver.poolMutex.RUnlock()
+// SubscribeFailover 订阅主从切换事件, chan满时丢弃事件, 调用返回的函数取消订阅
+func (s *sentinelClient) SubscribeFailover(size int) (<-chan FailoverEvent, func()) {
+	return s.events.subscribeFailover(size)
+}
 
-	return s.slaver.poolClient.Get()
+// SubscribeSentinelEvent 订阅sentinel所有事件, chan满时丢弃事件, 调用返回的函数取消订阅
+func (s *sentinelClient) SubscribeSentinelEvent(size int) (<-chan SentinelEvent, func()) {
+	return s.events.subscribeSentinelEvent(size)
 }
 
 // checkOptions 检查参数
 func (s *sentinelClient) checkOptions() error {
-	if len(s.options.sentinelHosts) == 0 || len(s.options.masterName) == 0 {
+	if s.options.logger == nil {
+		s.options.logger = logger.Default()
+	}
+
+	if len(s.options.sentinelHosts) == 0 || len(s.options.masterNames) == 0 {
+		return errOptions
+	}
+
+	// 去重, 同一个master-name只建一组连接池
+	names := make([]string, 0, len(s.options.masterNames))
+	seen := make(map[string]struct{}, len(s.options.masterNames))
+	for _, name := range s.options.masterNames {
+		if len(name) == 0 {
+			return errOptions
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	s.options.masterNames = names
+
+	// quorum超过sentinel数时永远达不到, 不超过半数时两个地址可能同时达到
+	if q := s.options.masterQuorum; q > 0 && (q > len(s.options.sentinelHosts) || q*2 <= len(s.options.sentinelHosts)) {
 		return errOptions
 	}
 
-	if s.options.maxActive <= 8 {
-		s.options.maxActive = 8
+	if s.options.balancer == nil {
+		s.options.balancer = RoundRobinBalancer()
 	}
 
-	if s.options.maxIdle <= 16 {
-		s.options.maxActive = 16
+	// 未通讯时长按秒比较, 不足整秒向上取整, 避免截断为0变成不限制
+	if s.options.maxSlaveLag > 0 && s.options.maxSlaveLag%time.Second != 0 {
+		s.options.maxSlaveLag = (s.options.maxSlaveLag/time.Second + 1) * time.Second
+	}
+
+	// 刷新间隔不短于检测间隔, 在检测时顺带刷新
+	if s.options.topologyRefreshDuration <= 0 {
+		s.options.topologyRefreshDuration = defaultOptions.topologyRefreshDuration
+	}
+	if s.options.topologyRefreshDuration < s.options.monitorStatusDuration {
+		s.options.topologyRefreshDuration = s.options.monitorStatusDuration
+	}
+
+	// 连接池大小决定借连接时等待多久, 只补默认值, 不覆盖配置
+	if s.options.maxActive <= 0 {
+		s.options.maxActive = defaultOptions.maxActive
+	}
+
+	if s.options.maxIdle <= 0 {
+		s.options.maxIdle = defaultOptions.maxIdle
 	}
 
 	return nil
@@ -149,15 +333,15 @@ func (s *sentinelClient) switchQuicklyHost(hosts []string) (string, error) {
 	}
 
 	if len(hosts) == 1 {
-		return hosts[1], nil
+		return hosts[0], nil
 	}
 
+	// 不关闭chan, 慢的goroutine返回时不会写已关闭的chan
 	var indexChan = make(chan int, len(hosts))
-	defer close(indexChan)
 
 	for i, host := range hosts {
 		go func(i int, host string) {
-			client, err := redis.Dial("tcp", host, redis.DialConnectTimeout(s.options.dialConnTimeout))
+			client, err := s.dialSentinel(host)
 			if err != nil {
 				indexChan <- connectError
 				return
@@ -173,8 +357,8 @@ func (s *sentinelClient) switchQuicklyHost(hosts []string) (string, error) {
 		}(i, host)
 	}
 
-	for index := range indexChan {
-		if index != connectError {
+	for range hosts {
+		if index := <-indexChan; index != connectError {
 			return hosts[index], nil
 		}
 	}
@@ -184,125 +368,218 @@ func (s *sentinelClient) switchQuicklyHost(hosts []string) (string, error) {
 
 // connectRedis 连接redis
 func (s *sentinelClient) connectRedis(host string) error {
-	conn, err := redis.Dial("tcp", host)
+	// 订阅连接没有事件时一直阻塞读, 不设读超时, 由monitorRedisStatusLoop定时ping检测
+	conn, err := s.dialSentinel(host, redis.DialReadTimeout(0))
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
-	s.pubSubConn = redis.PubSubConn{Conn: conn}
+	pubSubConn := redis.PubSubConn{Conn: conn}
 
-	err = s.pubSubConn.Subscribe("+switch-master")
+	// 订阅sentinel所有事件, 不只是+switch-master
+	if err = pubSubConn.PSubscribe("*"); err != nil {
+		conn.Close()
+	} else {
+		err = s.setPubSubConn(pubSubConn, host)
+	}
 
-	log.Printf("sentinel subscribe +switch-master, host:%s, err:%v\n", host, err)
+	if err != nil {
+		s.options.logger.Error("sentinel psubscribe err", logger.F("sentinel", host), logger.Err(err))
+	} else {
+		s.options.logger.Info("sentinel psubscribe", logger.F("sentinel", host))
+	}
 	return err
 }
 
-// subSentinelEvent sentinel订阅主从切换事件
+// subSentinelEvent sentinel订阅事件
 func (s *sentinelClient) subSentinelEvent() {
+	pubSubConn := s.getPubSubConn()
 	for {
-		msg := s.pubSubConn.Receive()
+		msg := pubSubConn.Receive()
 		switch msg.(type) {
 		case redis.Message:
 			m := msg.(redis.Message)
-			s.switchMaster(m.Channel, string(m.Data))
+			s.handleSentinelEvent(m.Channel, string(m.Data))
+		case redis.PMessage:
+			m := msg.(redis.PMessage)
+			s.handleSentinelEvent(m.Channel, string(m.Data))
 		case redis.Pong:
-			log.Printf("%s[master:%s] sentinel monitor msg:%+v\n", s.options.masterName, s.getMasterHost(), msg)
+			s.options.logger.Debug("sentinel pong", logger.F("data", msg.(redis.Pong).Data))
 		case error:
-			// 重连sentinel
+			if s.isClosed() {
+				return
+			}
+			// 重连sentinel, 由monitorRedisStatusLoop重新订阅
 			s.setPubSubStatus(connectError)
+			return
 		}
 	}
 }
 
 // monitorRedisStatusLoop 监控sentinel/slave状态
+// 每个检测间隔ping订阅连接并用长连接探测在用的slave, 每topologyRefreshDuration从sentinel刷新一次拓扑
 func (s *sentinelClient) monitorRedisStatusLoop() {
 	ticker := time.NewTicker(s.options.monitorStatusDuration)
+	defer ticker.Stop()
+
+	lastRefresh := time.Now()
 	for {
 		select {
-		case <-ticker.C:
-			// 主从
-			switch s.getPubSubStatus() {
-			case connectNormal:
-				if pong, err := redis.String(s.pubSubConn.Conn.Do("ping")); err != nil {
-					s.setPubSubStatus(connectError)
-					log.Printf("%s[master:%s] sentinel monitor pong:%v, err:%v\n", s.options.masterName, s.getMasterHost(), pong, err)
-				} else {
-					log.Printf("%s[master:%s] sentinel monitor pong:%v\n", s.options.masterName, s.getMasterHost(), pong)
-				}
-			case connectError:
-				// 重连sentinel, 开启新监控
-				sentinelHost, err := s.switchQuicklyHost(s.options.sentinelHosts)
-				if err != nil {
-					log.Printf("switch quickly host, err:%v\n", err)
-				} else {
-					if err := s.connectRedis(sentinelHost); err != nil {
-						log.Printf("connect sentinel, err:%v\n", err)
-					}
-					s.setPubSubStatus(connectNormal)
-					s.subSentinelEvent()
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.checkPubSub()
+
+			// 标记了master下线时每次检测都向sentinel确认, 错过事件时不会一直拒绝写
+			for _, g := range s.groups {
+				if g.isMasterDown() {
+					s.checkMasterDown(g, s.getSentinelHost())
 				}
 			}
 
-			// slave
-			switch s.getSlaveStatus() {
-			case connectNormal:
-				if pong, err := redis.String(s.slaver.conn.Do("ping")); err != nil {
-					s.setSlaveStatus(connectError)
-					log.Printf("%s[slave:%s] monitor err:%v", s.options.masterName, s.getSlaverHost(), err)
-				} else {
-					log.Printf("%s[slave:%s] monitor pong:%s", s.options.masterName, s.getSlaverHost(), pong)
-				}
-			case connectError:
-				sentinelHost, err := s.switchQuicklyHost(s.options.sentinelHosts)
-				if err != nil {
-					log.Printf("switch quickly host, err:%v\n", err)
-				} else {
-					if err = s.initRedisPool(sentinelHost, slave, false); err != nil {
-						log.Printf("switch slave error, cur slave is:%s[%s], err:%+v\n", s.options.masterName, s.getSlaverHost(), err)
-					} else {
-						s.setSlaveStatus(connectNormal)
-						log.Printf("switch slave ok, new slave is:%s[%s]\n", s.options.masterName, s.getSlaverHost())
-					}
+			if now.Sub(lastRefresh) < s.options.topologyRefreshDuration {
+				for _, g := range s.groups {
+					s.probeReplicas(g)
 				}
+				continue
 			}
+			lastRefresh = now
+			s.refreshTopology()
+		}
+	}
+}
+
+// checkPubSub ping订阅连接, 断开时重连sentinel开启新监控
+func (s *sentinelClient) checkPubSub() {
+	switch s.getPubSubStatus() {
+	case connectNormal:
+		if err := s.getPubSubConn().Ping(""); err != nil {
+			s.setPubSubStatus(connectError)
+			s.options.logger.Warn("sentinel ping err", logger.F("sentinel", s.getSentinelHost()), logger.Err(err))
+			s.setLastError(err)
+		}
+	case connectError:
+		sentinelHost, err := s.switchQuicklyHost(s.getSentinelHosts())
+		if err != nil {
+			s.options.logger.Error("switch quickly host err", logger.Err(err))
+			s.setLastError(err)
+			return
+		}
+		if err = s.connectRedis(sentinelHost); err != nil {
+			s.options.logger.Error("connect sentinel err", logger.F("sentinel", sentinelHost), logger.Err(err))
+			s.setLastError(err)
+			return
+		}
+		s.setPubSubStatus(connectNormal)
+		s.addReconnect()
+		s.goroutine(s.subSentinelEvent)
+
+		// 断开期间的事件已经错过, 按新sentinel的状态重新设置master下线标记
+		for _, g := range s.groups {
+			s.checkMasterDown(g, sentinelHost)
 		}
 	}
 }
 
+// refreshTopology 从sentinel刷新slave列表, quorum模式下校验master, 发现新增的sentinel
+// 订阅正常时用订阅的sentinel, 不再逐个ping所有sentinel
+func (s *sentinelClient) refreshTopology() {
+	sentinelHost := s.getSentinelHost()
+	if s.getPubSubStatus() != connectNormal {
+		var err error
+		if sentinelHost, err = s.switchQuicklyHost(s.getSentinelHosts()); err != nil {
+			s.options.logger.Error("switch quickly host err", logger.Err(err))
+			s.setLastError(err)
+			return
+		}
+	}
+
+	// slave, 按sentinel最新信息增删slave
+	for _, g := range s.groups {
+		if err := s.initRedisPool(g, sentinelHost, slave, false); err != nil {
+			s.options.logger.Warn("refresh slave err", logger.F("master", g.name), logger.Err(err))
+			s.setLastError(err)
+		}
+	}
+
+	// quorum模式下定时校验master, 补上被拒绝的切换
+	if s.options.masterQuorum > 0 {
+		for _, g := range s.groups {
+			s.checkMasterQuorum(g)
+		}
+	}
+
+	// 发现新增的sentinel
+	if err := s.discoverSentinels(sentinelHost); err != nil {
+		s.options.logger.Warn("discover sentinel err", logger.F("sentinel", sentinelHost), logger.Err(err))
+	}
+}
+
 // switchMaster 切换master
-func (s *sentinelClient) switchMaster(channel, data string) {
-	// 只关注主从切换
-	if !strings.HasPrefix(channel, "+switch-master") {
+func (s *sentinelClient) switchMaster(data string) {
+	event, err := parseSwitchMaster(data)
+	if err != nil {
+		s.options.logger.Warn("switch master format err", logger.F("data", data))
 		return
 	}
 
-	info := strings.Split(data, " ")
-	if len(info) != 5 {
-		log.Printf("switch master info err, data:%s\n", data)
+	// 按master-name路由到对应的主从组
+	g, err := s.getGroup(event.MasterName)
+	if err != nil {
+		s.options.logger.Debug("switch master not monitored", logger.F("master", event.MasterName), logger.F("data", data))
 		return
 	}
 
-	if !strings.EqualFold(info[0], s.options.masterName) {
-		log.Printf("switch master the same, cur master:%s, switch data:%+v", s.options.masterName, data)
-		return
+	event.Sentinel = s.getSentinelHost()
+
+	// quorum模式下多数sentinel确认新master后才切换, 等其他sentinel同步新配置, 超时才拒绝
+	// 拒绝后重新按quorum获取master, sentinel达成一致后再切换
+	if s.options.masterQuorum > 0 {
+		if err = s.waitMasterQuorum(g, event.NewAddr); err != nil {
+			s.options.logger.Error("switch master refused", logger.F("master", event.MasterName), logger.F("old", event.OldAddr), logger.F("new", event.NewAddr), logger.Err(err))
+			event.Err = err
+			s.notifyFailover(event)
+			s.reResolveMaster(g)
+			return
+		}
 	}
 
-	masterHost := net.JoinHostPort(info[3], info[4])
-	oldMasterHost := s.getMasterHost()
+	// 确认新master的角色, 不是master时拒绝切换并重新获取
+	if err = s.verifyMasterRole(event.NewAddr); err != nil {
+		s.options.logger.Error("switch master refused", logger.F("master", event.MasterName), logger.F("old", event.OldAddr), logger.F("new", event.NewAddr), logger.Err(err))
+		event.Err = err
+		s.notifyFailover(event)
+		s.reResolveMaster(g)
+		return
+	}
 
-	s.setMasterHost(masterHost)
+	s.swapMasterPool(g, event.NewAddr)
+	s.options.logger.Info("switch master", logger.F("master", event.MasterName), logger.F("old", event.OldAddr), logger.F("new", event.NewAddr))
 
-	s.master.poolMutex.Lock()
-	if s.master.poolClient != nil {
-		s.master.poolClient.Close()
+	if event.Epoch, err = s.getConfigEpoch(event.Sentinel, event.MasterName); err != nil {
+		s.options.logger.Warn("get config epoch err", logger.F("master", event.MasterName), logger.Err(err))
 	}
-	s.master.poolClient = s.createRedisPool(masterHost)
-	s.master.poolMutex.Unlock()
 
-	// 主从切换回调
+	s.notifyFailover(event)
+}
+
+// notifyFailover 主从切换回调并分发给订阅者
+func (s *sentinelClient) notifyFailover(event FailoverEvent) {
+	if g, err := s.getGroup(event.MasterName); err == nil {
+		g.recordFailover(event)
+	}
+	if event.Err != nil {
+		s.setLastError(event.Err)
+	}
 	if s.options.switchMasterHook != nil {
-		text := fmt.Sprintf("%s(old) --> %s(now)", oldMasterHost, masterHost)
-		s.options.switchMasterHook(text)
+		s.options.switchMasterHook(event)
+	}
+	s.publish(event)
+}
+
+// publish 分发事件给订阅者, 订阅者处理不及时丢弃事件时记录日志
+func (s *sentinelClient) publish(event interface{}) {
+	if dropped := s.events.publish(event); dropped > 0 {
+		s.options.logger.Warn("event dropped, subscriber full", logger.F("subscribers", dropped), logger.F("event", event))
 	}
 }
@@ -0,0 +1,309 @@
+package sentinelClient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// newTestClient 不经过sentinel, 直接用master地址初始化的客户端
+func newTestClient(masterName, masterAddr string, opts ...Option) *sentinelClient {
+	s := &sentinelClient{options: defaultOptions}
+	for _, o := range opts {
+		o(&s.options)
+	}
+	s.options.masterNames = []string{masterName}
+	if len(s.options.sentinelHosts) == 0 {
+		s.options.sentinelHosts = []string{"127.0.0.1:0"} // 只用于通过checkOptions
+	}
+	s.checkOptions()
+
+	g := newMasterGroup(masterName)
+	s.groups = map[string]*masterGroup{masterName: g}
+	s.swapMasterPool(g, masterAddr)
+	return s
+}
+
+func TestSentinelClient_GetMasterClientContext(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	s.options.maxActive = 1
+	s.swapMasterPool(s.groups["mymaster"], m.addr())
+
+	conn, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 连接池满, 等待到超时
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = s.GetMasterClientContext(ctx, "mymaster"); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	// 不带ctx的接口和内部借连接最多等待dialTimeout
+	s.options.dialTimeout = 50 * time.Millisecond
+	if err = s.GetMasterClient("mymaster").Err(); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if _, err = s.getMasterReplOffset(s.groups["mymaster"]); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	// 归还后可以借到
+	conn.Close()
+	conn, err = s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// 没有slave时读master
+	conn, err = s.GetSlaverClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if _, err = s.GetMasterClientContext(context.Background(), "unknown"); err != errUnknownMasterName {
+		t.Fatalf("err = %v, want errUnknownMasterName", err)
+	}
+}
+
+func TestSentinelClient_SwitchMasterByName(t *testing.T) {
+	m1 := newFakeServer(t, fakeRedis("master"))
+	defer m1.close()
+	m2 := newFakeServer(t, fakeRedis("master"))
+	defer m2.close()
+	m3 := newFakeServer(t, fakeRedis("master"))
+	defer m3.close()
+
+	s := newTestClient("m1", m1.addr())
+	defer s.Close(context.Background())
+	g2 := newMasterGroup("m2")
+	s.groups["m2"] = g2
+	s.swapMasterPool(g2, m2.addr())
+
+	// 只切换对应master-name的连接池
+	host, port, _ := net.SplitHostPort(m1.addr())
+	newHost, newPort, _ := net.SplitHostPort(m3.addr())
+	s.handleSentinelEvent("+switch-master", strings.Join([]string{"m1", host, port, newHost, newPort}, " "))
+	if addr := s.groups["m1"].getMasterHost(); addr != m3.addr() {
+		t.Fatalf("m1 master = %s, want %s", addr, m3.addr())
+	}
+	if addr := g2.getMasterHost(); addr != m2.addr() {
+		t.Fatalf("m2 master = %s, want unchanged %s", addr, m2.addr())
+	}
+
+	// 没有监控的master-name忽略
+	s.handleSentinelEvent("+switch-master", strings.Join([]string{"unknown", newHost, newPort, host, port}, " "))
+	if addr := s.groups["m1"].getMasterHost(); addr != m3.addr() {
+		t.Fatalf("m1 master = %s, want %s", addr, m3.addr())
+	}
+	if addr := g2.getMasterHost(); addr != m2.addr() {
+		t.Fatalf("m2 master = %s, want unchanged %s", addr, m2.addr())
+	}
+	if len(s.groups) != 2 {
+		t.Fatalf("groups = %d, want 2", len(s.groups))
+	}
+
+	conn := s.GetMasterClient("unknown")
+	if _, err := conn.Do("PING"); err != errUnknownMasterName {
+		t.Fatalf("err = %v, want errUnknownMasterName", err)
+	}
+	if err := conn.Err(); err != errUnknownMasterName {
+		t.Fatalf("err = %v, want errUnknownMasterName", err)
+	}
+	if _, err := s.GetSlaverClient("unknown").Do("GET", "k"); err != errUnknownMasterName {
+		t.Fatalf("err = %v, want errUnknownMasterName", err)
+	}
+}
+
+func TestSentinelClient_CheckOptions(t *testing.T) {
+	s := &sentinelClient{options: defaultOptions}
+	s.options.sentinelHosts = []string{"127.0.0.1:26379"}
+	s.options.masterNames = []string{"mymaster"}
+	s.options.maxSlaveLag = 500 * time.Millisecond
+	if err := s.checkOptions(); err != nil {
+		t.Fatal(err)
+	}
+	// 不足1秒向上取整, 不能截断为不限制
+	if s.options.maxSlaveLag != time.Second || s.lagLimit().seconds != 1 {
+		t.Fatalf("maxSlaveLag = %v, want 1s", s.options.maxSlaveLag)
+	}
+
+	// 连接池大小只补默认值
+	s.options.maxActive, s.options.maxIdle = 4, 0
+	if err := s.checkOptions(); err != nil {
+		t.Fatal(err)
+	}
+	if s.options.maxActive != 4 || s.options.maxIdle != defaultOptions.maxIdle {
+		t.Fatalf("maxActive = %d, maxIdle = %d", s.options.maxActive, s.options.maxIdle)
+	}
+
+	// quorum须超过sentinel数的一半且不超过sentinel数
+	s.options.sentinelHosts = []string{"127.0.0.1:26379", "127.0.0.1:26380", "127.0.0.1:26381", "127.0.0.1:26382"}
+	for quorum, want := range map[int]error{0: nil, 2: errOptions, 3: nil, 4: nil, 5: errOptions} {
+		s.options.masterQuorum = quorum
+		if err := s.checkOptions(); err != want {
+			t.Errorf("quorum %d: err = %v, want %v", quorum, err, want)
+		}
+	}
+}
+
+func TestSentinelClient_Close(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	conn, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 借出的连接未归还, 等到超时
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = s.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	conn.Close()
+
+	if _, err = s.GetMasterClientContext(context.Background(), "mymaster"); err != errClosed {
+		t.Fatalf("err = %v, want errClosed", err)
+	}
+	if err = s.Close(context.Background()); err != errClosed {
+		t.Fatalf("err = %v, want errClosed", err)
+	}
+
+	// Close之后重连sentinel得到的订阅连接直接关闭
+	sentinel := newFakeServer(t, fakeSentinel("mymaster", m.addr()))
+	defer sentinel.close()
+	if err = s.connectRedis(sentinel.addr()); err != errClosed {
+		t.Fatalf("connect after close err = %v, want errClosed", err)
+	}
+	sub, err := redis.Dial("tcp", sentinel.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.setPubSubConn(redis.PubSubConn{Conn: sub}, sentinel.addr()); err != errClosed || sub.Err() == nil {
+		t.Fatalf("err = %v, conn err = %v, want conn closed", err, sub.Err())
+	}
+}
+
+func TestSentinelClient_CloseDrain(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	conn, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		conn.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordLogger 记录日志消息的Logger
+type recordLogger struct {
+	mutex sync.Mutex
+	msgs  []string
+}
+
+func (l *recordLogger) record(msg string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *recordLogger) Debug(msg string, fields ...logger.Field) { l.record(msg) }
+func (l *recordLogger) Info(msg string, fields ...logger.Field)  { l.record(msg) }
+func (l *recordLogger) Warn(msg string, fields ...logger.Field)  { l.record(msg) }
+func (l *recordLogger) Error(msg string, fields ...logger.Field) { l.record(msg) }
+
+func TestSentinelClient_Logger(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	l := &recordLogger{}
+	s := newTestClient("mymaster", m.addr(), Logger(l))
+
+	if err := s.initRedisPool(s.groups["mymaster"], "", 0, false); err != errRole {
+		t.Fatalf("err = %v, want errRole", err)
+	}
+
+	s.handleSentinelEvent("+try-failover", "master mymaster 127.0.0.1 6379")
+	if len(l.msgs) != 1 || l.msgs[0] != "try failover" {
+		t.Fatalf("msgs = %v, want [try failover]", l.msgs)
+	}
+
+	// 传nil使用默认日志
+	s = newTestClient("mymaster", m.addr(), Logger(nil))
+	if s.options.logger == nil {
+		t.Fatal("logger nil, want default")
+	}
+}
+
+func TestSentinelClient_MonitorRefresh(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+	var pings int32
+	r := newFakeServer(t, func(args []string) interface{} {
+		if strings.EqualFold(args[0], "PING") {
+			atomic.AddInt32(&pings, 1)
+		}
+		return fakeRedis("slave")(args)
+	})
+	defer r.close()
+
+	var queries int32
+	slaveHost, slavePort, _ := net.SplitHostPort(r.addr())
+	sentinel := newFakeServer(t, func(args []string) interface{} {
+		if strings.EqualFold(args[0], "SENTINEL") && len(args) == 3 && strings.EqualFold(args[1], "slaves") {
+			atomic.AddInt32(&queries, 1)
+			return []interface{}{
+				[]string{"name", r.addr(), "ip", slaveHost, "port", slavePort, "flags", "slave", "master-link-status", "ok"},
+			}
+		}
+		return fakeSentinel("mymaster", m.addr())(args)
+	})
+	defer sentinel.close()
+
+	s := New()
+	if err := s.Init(SentinelHosts([]string{sentinel.addr()}), MasterName("mymaster"), Logger(logger.Nop()),
+		MonitorStatusDuration(10*time.Millisecond), TopologyRefreshDuration(200*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	s.Close(context.Background())
+
+	// 每个检测间隔探测slave, 只在刷新间隔查询sentinel, 探测复用一个连接
+	if n := atomic.LoadInt32(&queries); n < 1 || n > 3 {
+		t.Fatalf("SENTINEL slaves queried %d times, want refresh interval only", n)
+	}
+	if n := atomic.LoadInt32(&pings); n < 10 {
+		t.Fatalf("slave pinged %d times, want every monitor tick", n)
+	}
+	if n := r.accepted(); n != 1 {
+		t.Fatalf("slave dialed %d times, want 1 persistent probe connection", n)
+	}
+}
@@ -0,0 +1,337 @@
+package sentinelClient
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// errCloseConn handler返回时直接断开连接, 模拟连接重置
+var errCloseConn = errors.New("close conn")
+
+// fakeHandler 处理一条命令, 返回值按类型编码: string为状态回复, []byte为bulk, error为错误回复
+type fakeHandler func(args []string) interface{}
+
+// fakeServer 测试用的redis/sentinel服务, 只实现RESP协议, 用完需要close
+type fakeServer struct {
+	ln       net.Listener
+	handler  fakeHandler
+	username string // 非空时要求AUTH username password
+	password string // 非空时要求先AUTH
+	mutex    sync.Mutex
+	conns    []net.Conn
+	subs     map[*fakeSubConn]struct{} // 订阅模式的连接
+}
+
+// fakeSubConn 订阅模式的连接, publish和命令回复并发写
+type fakeSubConn struct {
+	mutex    sync.Mutex
+	w        *bufio.Writer
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+func (c *fakeSubConn) write(reply interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	writeReply(c.w, reply)
+	return c.w.Flush()
+}
+
+func newFakeServer(t *testing.T, handler fakeHandler) *fakeServer {
+	return newFakeAuthServer(t, "", "", handler)
+}
+
+// newFakeAuthServer password非空时要求先AUTH, username非空时要求AUTH username password
+func newFakeAuthServer(t *testing.T, username, password string, handler fakeHandler) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startFakeServer(ln, username, password, handler)
+}
+
+func newFakeTLSServer(t *testing.T, config *tls.Config, handler fakeHandler) *fakeServer {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startFakeServer(ln, "", "", handler)
+}
+
+// startFakeServer 账号在开始accept前设置
+func startFakeServer(ln net.Listener, username, password string, handler fakeHandler) *fakeServer {
+	s := &fakeServer{ln: ln, handler: handler, username: username, password: password}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+// accepted 累计接受的连接数
+func (s *fakeServer) accepted() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.conns)
+}
+
+func (s *fakeServer) close() {
+	s.ln.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *fakeServer) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns = append(s.conns, c)
+		s.mutex.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+func (s *fakeServer) serveConn(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	sc := &fakeSubConn{w: w, channels: map[string]bool{}, patterns: map[string]bool{}}
+	defer s.removeSub(sc)
+	authed := len(s.password) == 0
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		if authed && s.pubsub(sc, args) {
+			continue
+		}
+
+		sc.mutex.Lock()
+		switch {
+		case strings.EqualFold(args[0], "AUTH"):
+			authed = s.checkAuth(args[1:])
+			if authed {
+				writeReply(w, "OK")
+			} else {
+				writeReply(w, errors.New("WRONGPASS invalid username-password pair"))
+			}
+		case !authed:
+			writeReply(w, errors.New("NOAUTH Authentication required."))
+		default:
+			reply := s.handler(args)
+			if reply == errCloseConn {
+				return
+			}
+			writeReply(w, reply)
+		}
+		err = w.Flush()
+		sc.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// pubsub 处理订阅相关命令, 不是订阅命令时返回false
+func (s *fakeServer) pubsub(sc *fakeSubConn, args []string) bool {
+	cmd := strings.ToLower(args[0])
+	var set map[string]bool
+	switch cmd {
+	case "subscribe", "unsubscribe":
+		set = sc.channels
+	case "psubscribe", "punsubscribe":
+		set = sc.patterns
+	case "ping":
+		s.mutex.Lock()
+		_, subscribed := s.subs[sc]
+		s.mutex.Unlock()
+		if !subscribed {
+			return false
+		}
+		sc.write([]interface{}{[]byte("pong"), []byte("")})
+		return true
+	default:
+		return false
+	}
+
+	s.mutex.Lock()
+	for _, name := range args[1:] {
+		if strings.HasSuffix(cmd, "unsubscribe") {
+			delete(set, name)
+		} else {
+			set[name] = true
+		}
+	}
+	count := len(sc.channels) + len(sc.patterns)
+	if s.subs == nil {
+		s.subs = map[*fakeSubConn]struct{}{}
+	}
+	if count > 0 {
+		s.subs[sc] = struct{}{}
+	} else {
+		delete(s.subs, sc)
+	}
+	s.mutex.Unlock()
+
+	for _, name := range args[1:] {
+		sc.write([]interface{}{[]byte(cmd), []byte(name), int64(count)})
+	}
+	return true
+}
+
+func (s *fakeServer) removeSub(sc *fakeSubConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subs, sc)
+}
+
+// publish 发送消息给订阅了channel或匹配模式的连接, 返回收到的连接数
+func (s *fakeServer) publish(channel, data string) int {
+	s.mutex.Lock()
+	var targets []*fakeSubConn
+	var messages [][]interface{}
+	for sc := range s.subs {
+		if sc.channels[channel] {
+			targets = append(targets, sc)
+			messages = append(messages, []interface{}{[]byte("message"), []byte(channel), []byte(data)})
+		}
+		for pattern := range sc.patterns {
+			if ok, _ := path.Match(pattern, channel); ok {
+				targets = append(targets, sc)
+				messages = append(messages, []interface{}{[]byte("pmessage"), []byte(pattern), []byte(channel), []byte(data)})
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	for i, sc := range targets {
+		sc.write(messages[i])
+	}
+	return len(targets)
+}
+
+func (s *fakeServer) checkAuth(args []string) bool {
+	switch len(args) {
+	case 1:
+		return len(s.username) == 0 && args[0] == s.password
+	case 2:
+		return args[0] == s.username && args[1] == s.password
+	}
+	return false
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimRight(line, "\r\n")[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case error:
+		fmt.Fprintf(w, "-%s\r\n", v.Error())
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, s := range v {
+			writeReply(w, []byte(s))
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	default:
+		panic(fmt.Sprintf("fake server unsupported reply %T", reply))
+	}
+}
+
+// fakeSentinel 返回固定master地址的sentinel
+func fakeSentinel(masterName, masterAddr string) fakeHandler {
+	host, port, _ := net.SplitHostPort(masterAddr)
+	return func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			return "PONG"
+		case "SENTINEL":
+			if len(args) == 3 && strings.EqualFold(args[1], "get-master-addr-by-name") && args[2] == masterName {
+				return []string{host, port}
+			}
+			return []interface{}{}
+		}
+		return fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+}
+
+// fakeRedis 返回固定ROLE的redis实例
+func fakeRedis(role string) fakeHandler {
+	return func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			return "PONG"
+		case "ROLE":
+			return []interface{}{[]byte(role), int64(0), []interface{}{}}
+		case "SET":
+			if role != "master" {
+				return errors.New("READONLY You can't write against a read only replica.")
+			}
+			return "OK"
+		}
+		return fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+}
@@ -0,0 +1,162 @@
+package sentinelClient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Stats 客户端运行统计, 用于导出到监控
+type Stats struct {
+	Sentinel      string                // 当前订阅的sentinel
+	Sentinels     []string              // 已知的所有sentinel, 包括自动发现的
+	PubSubStatus  string                // 订阅状态, normal/error/closed
+	Failovers     uint64                // 所有主从组完成的切换次数
+	Reconnects    uint64                // sentinel订阅重连次数
+	LastError     string                // 最近一次后台错误, 没有为空
+	LastErrorTime time.Time             // 最近一次后台错误的时间
+	Groups        map[string]GroupStats // master-name对应的主从组统计
+}
+
+// GroupStats 主从组统计
+type GroupStats struct {
+	MasterName   string         // master-name
+	Master       PoolStats      // 当前master连接池
+	MasterDown   bool           // sentinel报告master下线或正在切换
+	Generation   uint64         // master连接池代数, 每次切换加1
+	Replicas     []ReplicaStats // 可用slave
+	Failovers    uint64         // 完成的切换次数
+	LastFailover *FailoverEvent // 最近一次切换, 包括被拒绝的, 没有为nil
+}
+
+// PoolStats 连接池统计
+type PoolStats struct {
+	Host        string // 地址
+	ActiveCount int    // 连接数, 包括借出和空闲的
+	IdleCount   int    // 空闲连接数
+}
+
+// ReplicaStats slave统计
+type ReplicaStats struct {
+	ReplicaState
+	ActiveCount int  // 连接数, 包括借出和空闲的
+	IdleCount   int  // 空闲连接数
+	Down        bool // sentinel报告下线或定时探测失败, 不参与读
+}
+
+// clientStats 客户端级别的计数
+type clientStats struct {
+	mutex         sync.Mutex
+	reconnects    uint64
+	lastError     error
+	lastErrorTime time.Time
+}
+
+// failoverStats 主从组的切换计数
+type failoverStats struct {
+	mutex        sync.Mutex
+	failovers    uint64
+	lastFailover *FailoverEvent
+}
+
+// Stats 获取客户端运行统计
+func (s *sentinelClient) Stats() Stats {
+	stats := Stats{
+		Sentinel:     s.getSentinelHost(),
+		Sentinels:    s.getSentinelHosts(),
+		PubSubStatus: "normal",
+		Groups:       make(map[string]GroupStats, len(s.groups)),
+	}
+	if s.getPubSubStatus() != connectNormal {
+		stats.PubSubStatus = "error"
+	}
+	if s.isClosed() {
+		stats.PubSubStatus = "closed"
+	}
+
+	s.stats.mutex.Lock()
+	stats.Reconnects = s.stats.reconnects
+	if s.stats.lastError != nil {
+		stats.LastError = s.stats.lastError.Error()
+		stats.LastErrorTime = s.stats.lastErrorTime
+	}
+	s.stats.mutex.Unlock()
+
+	for name, g := range s.groups {
+		gs := g.stats()
+		stats.Failovers += gs.Failovers
+		stats.Groups[name] = gs
+	}
+	return stats
+}
+
+func (g *masterGroup) stats() GroupStats {
+	gs := GroupStats{
+		MasterName: g.name,
+		MasterDown: g.isMasterDown(),
+		Replicas:   g.slaves.stats(),
+	}
+
+	g.master.poolMutex.RLock()
+	if g.master.poolGen != nil {
+		gs.Master = poolStats(g.master.poolGen.host, g.master.poolGen.pool)
+	}
+	gs.Generation = g.master.generation
+	g.master.poolMutex.RUnlock()
+
+	g.failover.mutex.Lock()
+	gs.Failovers = g.failover.failovers
+	if g.failover.lastFailover != nil {
+		event := *g.failover.lastFailover
+		gs.LastFailover = &event
+	}
+	g.failover.mutex.Unlock()
+	return gs
+}
+
+// recordFailover 记录切换事件, 被拒绝的切换只记录为最近一次切换
+func (g *masterGroup) recordFailover(event FailoverEvent) {
+	g.failover.mutex.Lock()
+	defer g.failover.mutex.Unlock()
+	if event.Err == nil {
+		g.failover.failovers++
+	}
+	g.failover.lastFailover = &event
+}
+
+func (rs *replicaSet) stats() []ReplicaStats {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	stats := make([]ReplicaStats, len(rs.replicas))
+	for i, r := range rs.replicas {
+		ps := poolStats(r.host, r.pool)
+		stats[i] = ReplicaStats{
+			ReplicaState: r.state(),
+			ActiveCount:  ps.ActiveCount,
+			IdleCount:    ps.IdleCount,
+			Down:         !r.available(),
+		}
+	}
+	return stats
+}
+
+func poolStats(host string, pool *redis.Pool) PoolStats {
+	stats := pool.Stats()
+	return PoolStats{Host: host, ActiveCount: stats.ActiveCount, IdleCount: stats.IdleCount}
+}
+
+// setLastError 记录最近一次后台错误
+func (s *sentinelClient) setLastError(err error) {
+	s.stats.mutex.Lock()
+	defer s.stats.mutex.Unlock()
+	s.stats.lastError = err
+	s.stats.lastErrorTime = time.Now()
+}
+
+func (s *sentinelClient) addReconnect() {
+	s.stats.mutex.Lock()
+	defer s.stats.mutex.Unlock()
+	s.stats.reconnects++
+}
@@ -0,0 +1,56 @@
+package sentinelClient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSentinelClient_Stats(t *testing.T) {
+	m1 := newFakeServer(t, fakeRedis("master"))
+	defer m1.close()
+	m2 := newFakeServer(t, fakeRedis("master"))
+	defer m2.close()
+
+	s := newTestClient("mymaster", m1.addr())
+	defer s.Close(context.Background())
+
+	conn, err := s.GetMasterClientContext(context.Background(), "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Do("PING"); err != nil {
+		t.Fatal(err)
+	}
+
+	gs := s.Stats().Groups["mymaster"]
+	if gs.Master.Host != m1.addr() || gs.Master.ActiveCount != 1 || gs.Master.IdleCount != 0 {
+		t.Fatalf("master stats = %+v, want 1 active on %s", gs.Master, m1.addr())
+	}
+	conn.Close()
+
+	gs = s.Stats().Groups["mymaster"]
+	if gs.Master.IdleCount != 1 {
+		t.Fatalf("idle = %d, want 1", gs.Master.IdleCount)
+	}
+
+	s.changeMaster(s.groups["mymaster"], m2.addr())
+	s.notifyFailover(FailoverEvent{MasterName: "mymaster", OldAddr: m2.addr(), NewAddr: m1.addr(), Err: errNotMaster})
+
+	stats := s.Stats()
+	gs = stats.Groups["mymaster"]
+	if stats.Failovers != 1 || gs.Failovers != 1 || gs.Generation != 2 {
+		t.Fatalf("failovers = %d/%d generation = %d, want 1/1/2", stats.Failovers, gs.Failovers, gs.Generation)
+	}
+	if gs.Master.Host != m2.addr() {
+		t.Fatalf("master = %s, want %s", gs.Master.Host, m2.addr())
+	}
+	if gs.LastFailover == nil || gs.LastFailover.Err != errNotMaster {
+		t.Fatalf("last failover = %+v, want refused event", gs.LastFailover)
+	}
+	if stats.LastError != errNotMaster.Error() || stats.LastErrorTime.IsZero() {
+		t.Fatalf("last error = %q, want %q", stats.LastError, errNotMaster)
+	}
+	if stats.PubSubStatus != "normal" {
+		t.Fatalf("pubsub = %s, want normal", stats.PubSubStatus)
+	}
+}
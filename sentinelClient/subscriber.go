@@ -0,0 +1,345 @@
+package sentinelClient
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+var errSubscriberClosed = errors.New("subscriber closed")
+
+// SubMessage 订阅收到的消息
+// Gap为true时不是消息, 表示订阅连接断开后已重新订阅, Err为断开原因, 断开期间的消息可能丢失
+type SubMessage struct {
+	Channel string    // 频道
+	Pattern string    // 模式订阅时匹配的模式
+	Data    []byte    // 消息内容
+	Gap     bool      // 重新订阅通知
+	Err     error     // 订阅断开的原因
+	Time    time.Time // 收到消息或重新订阅的时间
+}
+
+// Subscriber 在master上订阅频道, 主从切换或连接断开后自动连接新master并重新订阅
+type Subscriber struct {
+	s        *sentinelClient
+	g        *masterGroup
+	mutex    sync.Mutex          // 保护订阅集合和写连接
+	channels map[string]struct{} // 订阅的频道
+	patterns map[string]struct{} // 订阅的模式
+	conn     redis.Conn          // 当前订阅连接, 断开时为nil
+	messages chan SubMessage
+	wake     chan struct{} // 没有连接时添加订阅, 通知连接
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewSubscriber 创建master-name对应主从组的订阅, size为消息chan缓冲大小
+// 消息chan满时阻塞接收, 需要及时读取Messages()
+func (s *sentinelClient) NewSubscriber(masterName string, size int) (*Subscriber, error) {
+	if s.isClosed() {
+		return nil, errClosed
+	}
+
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscriber{
+		s:        s,
+		g:        g,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		messages: make(chan SubMessage, size),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if !s.goroutine(sub.run) {
+		return nil, errClosed
+	}
+	return sub, nil
+}
+
+// Messages 消息chan, Close或客户端关闭后关闭
+func (sub *Subscriber) Messages() <-chan SubMessage {
+	return sub.messages
+}
+
+// Subscribe 订阅频道
+func (sub *Subscriber) Subscribe(channels ...string) error {
+	return sub.update(sub.channels, "SUBSCRIBE", channels, true)
+}
+
+// PSubscribe 订阅模式
+func (sub *Subscriber) PSubscribe(patterns ...string) error {
+	return sub.update(sub.patterns, "PSUBSCRIBE", patterns, true)
+}
+
+// Unsubscribe 取消订阅频道
+func (sub *Subscriber) Unsubscribe(channels ...string) error {
+	return sub.update(sub.channels, "UNSUBSCRIBE", channels, false)
+}
+
+// PUnsubscribe 取消订阅模式
+func (sub *Subscriber) PUnsubscribe(patterns ...string) error {
+	return sub.update(sub.patterns, "PUNSUBSCRIBE", patterns, false)
+}
+
+// update 修改订阅集合, 已连接时立即发送命令, 未连接时重连后统一订阅
+func (sub *Subscriber) update(set map[string]struct{}, cmd string, names []string, add bool) error {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	select {
+	case <-sub.stop:
+		return errSubscriberClosed
+	default:
+	}
+
+	for _, name := range names {
+		if add {
+			set[name] = struct{}{}
+		} else {
+			delete(set, name)
+		}
+	}
+
+	if sub.conn == nil {
+		if add {
+			select {
+			case sub.wake <- struct{}{}:
+			default:
+			}
+		}
+		return nil
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if err := sub.conn.Send(cmd, redis.Args{}.AddFlat(names)...); err != nil {
+		return err
+	}
+	return sub.conn.Flush()
+}
+
+// Close 取消所有订阅并关闭连接, 等待后台goroutine退出
+func (sub *Subscriber) Close() error {
+	sub.once.Do(func() {
+		sub.mutex.Lock()
+		close(sub.stop)
+		if sub.conn != nil {
+			sub.conn.Close()
+		}
+		sub.mutex.Unlock()
+	})
+	<-sub.done
+	return nil
+}
+
+// run 连接master并订阅, 断开后等新master或退避后重连, 直到Close或客户端关闭
+func (sub *Subscriber) run() {
+	defer close(sub.done)
+	defer close(sub.messages)
+
+	var (
+		lost    error // 上次断开的原因, 重新订阅成功后发送Gap通知
+		attempt int
+	)
+	for {
+		if !sub.waitSubscriptions() {
+			return
+		}
+		swapped := sub.g.masterSwapped()
+
+		conn, err := sub.connect()
+		if err == nil {
+			attempt = 0
+			if lost != nil && !sub.deliver(SubMessage{Gap: true, Err: lost, Time: time.Now()}) {
+				sub.disconnect(conn)
+				return
+			}
+			err = sub.receive(conn, swapped)
+			sub.disconnect(conn)
+		}
+
+		if sub.stopped() {
+			return
+		}
+		// 取消了所有订阅, 不是异常断开
+		if !sub.hasSubscriptions() {
+			lost, attempt = nil, 0
+			continue
+		}
+		if lost == nil {
+			sub.s.options.logger.Warn("subscriber disconnected", logger.F("master", sub.g.name), logger.Err(err))
+		}
+		lost = err
+
+		// 主从切换时立即重连, 否则退避
+		backoff := sub.s.options.retryPolicy.backoff(attempt)
+		attempt++
+		select {
+		case <-swapped:
+		case <-time.After(backoff):
+		case <-sub.stop:
+			return
+		case <-sub.s.stop:
+			return
+		}
+	}
+}
+
+// waitSubscriptions 等到有订阅, Close或客户端关闭时返回false
+func (sub *Subscriber) waitSubscriptions() bool {
+	for !sub.hasSubscriptions() {
+		select {
+		case <-sub.wake:
+		case <-sub.stop:
+			return false
+		case <-sub.s.stop:
+			return false
+		}
+	}
+	return true
+}
+
+func (sub *Subscriber) hasSubscriptions() bool {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	return len(sub.channels)+len(sub.patterns) > 0
+}
+
+// connect 连接当前master并订阅所有频道和模式
+func (sub *Subscriber) connect() (redis.Conn, error) {
+	host := sub.g.getMasterHost()
+	conn, err := sub.s.dialRedis(host, redis.DialConnectTimeout(sub.s.options.dialConnTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	select {
+	case <-sub.stop:
+		conn.Close()
+		return nil, errSubscriberClosed
+	default:
+	}
+
+	if err = subscribeAll(conn, "SUBSCRIBE", sub.channels); err == nil {
+		err = subscribeAll(conn, "PSUBSCRIBE", sub.patterns)
+	}
+	if err == nil {
+		err = conn.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	sub.conn = conn
+	return conn, nil
+}
+
+func subscribeAll(conn redis.Conn, cmd string, set map[string]struct{}) error {
+	if len(set) == 0 {
+		return nil
+	}
+	args := make(redis.Args, 0, len(set))
+	for name := range set {
+		args = append(args, name)
+	}
+	return conn.Send(cmd, args...)
+}
+
+func (sub *Subscriber) disconnect(conn redis.Conn) {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	if sub.conn == conn {
+		sub.conn = nil
+	}
+	conn.Close()
+}
+
+// receive 接收消息直到连接出错, 定时ping检测连接, master切换时主动断开
+func (sub *Subscriber) receive(conn redis.Conn, swapped <-chan struct{}) error {
+	interval := sub.s.options.monitorStatusDuration
+	exit := make(chan struct{})
+	defer close(exit)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// 没有订阅时PING的回复不是pubsub格式, 不发
+				var err error
+				sub.mutex.Lock()
+				if len(sub.channels)+len(sub.patterns) > 0 {
+					err = redis.PubSubConn{Conn: conn}.Ping("")
+				}
+				sub.mutex.Unlock()
+				if err != nil {
+					return
+				}
+			case <-swapped:
+				conn.Close()
+				return
+			case <-sub.s.stop:
+				conn.Close()
+				return
+			case <-exit:
+				return
+			}
+		}
+	}()
+
+	psc := redis.PubSubConn{Conn: conn}
+	for {
+		// 3个ping周期没有收到任何回复认为连接已断开
+		switch msg := psc.ReceiveWithTimeout(3 * interval).(type) {
+		case redis.Message:
+			m := SubMessage{Channel: msg.Channel, Data: msg.Data, Time: time.Now()}
+			if !sub.deliver(m) {
+				return errSubscriberClosed
+			}
+		case redis.PMessage:
+			m := SubMessage{Channel: msg.Channel, Pattern: msg.Pattern, Data: msg.Data, Time: time.Now()}
+			if !sub.deliver(m) {
+				return errSubscriberClosed
+			}
+		case error:
+			return msg
+		}
+	}
+}
+
+// deliver 发送消息, Close或客户端关闭时返回false
+func (sub *Subscriber) deliver(m SubMessage) bool {
+	select {
+	case sub.messages <- m:
+		return true
+	case <-sub.stop:
+		return false
+	case <-sub.s.stop:
+		return false
+	}
+}
+
+func (sub *Subscriber) stopped() bool {
+	select {
+	case <-sub.stop:
+		return true
+	case <-sub.s.stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+package sentinelClient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitPublish 等订阅生效后发布消息
+func waitPublish(t *testing.T, srv *fakeServer, channel, data string) {
+	deadline := time.Now().Add(time.Second)
+	for srv.publish(channel, data) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no subscriber on %s for %s", srv.addr(), channel)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func receiveMessage(t *testing.T, sub *Subscriber) SubMessage {
+	select {
+	case m, ok := <-sub.Messages():
+		if !ok {
+			t.Fatal("messages closed")
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("receive message timeout")
+	}
+	return SubMessage{}
+}
+
+func TestSubscriber_Resubscribe(t *testing.T) {
+	m1 := newFakeServer(t, fakeRedis("master"))
+	defer m1.close()
+	m2 := newFakeServer(t, fakeRedis("master"))
+	defer m2.close()
+
+	s := newTestClient("mymaster", m1.addr(), MonitorStatusDuration(20*time.Millisecond))
+	defer s.Close(context.Background())
+
+	sub, err := s.NewSubscriber("mymaster", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if err = sub.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	if err = sub.PSubscribe("order.*"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitPublish(t, m1, "news", "hello")
+	if m := receiveMessage(t, sub); m.Gap || m.Channel != "news" || string(m.Data) != "hello" {
+		t.Fatalf("message = %+v, want news/hello", m)
+	}
+	waitPublish(t, m1, "order.1", "paid")
+	if m := receiveMessage(t, sub); m.Pattern != "order.*" || m.Channel != "order.1" || string(m.Data) != "paid" {
+		t.Fatalf("message = %+v, want order.*/order.1/paid", m)
+	}
+
+	// 主从切换后在新master上重新订阅, 先收到Gap通知
+	s.changeMaster(s.groups["mymaster"], m2.addr())
+	if m := receiveMessage(t, sub); !m.Gap || m.Err == nil {
+		t.Fatalf("message = %+v, want gap", m)
+	}
+	waitPublish(t, m2, "news", "again")
+	if m := receiveMessage(t, sub); m.Channel != "news" || string(m.Data) != "again" {
+		t.Fatalf("message = %+v, want news/again", m)
+	}
+
+	// 取消订阅后不再收到
+	if err = sub.Unsubscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for m2.publish("news", "ignored") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("still subscribed after unsubscribe")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Close后chan中剩余的消息读完即关闭
+	sub.Close()
+	for m := range sub.Messages() {
+		if m.Channel != "news" {
+			t.Fatalf("message = %+v, want buffered news", m)
+		}
+	}
+	if err = sub.Subscribe("news"); err != errSubscriberClosed {
+		t.Fatalf("err = %v, want %v", err, errSubscriberClosed)
+	}
+}
+
+func TestSubscriber_Reconnect(t *testing.T) {
+	m := newFakeServer(t, fakeRedis("master"))
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr(), MonitorStatusDuration(20*time.Millisecond))
+	defer s.Close(context.Background())
+
+	sub, err := s.NewSubscriber("mymaster", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	sub.Subscribe("news")
+	waitPublish(t, m, "news", "1")
+	receiveMessage(t, sub)
+
+	// 连接断开后退避重连同一个master
+	m.mutex.Lock()
+	for _, c := range m.conns {
+		c.Close()
+	}
+	m.mutex.Unlock()
+
+	if msg := receiveMessage(t, sub); !msg.Gap {
+		t.Fatalf("message = %+v, want gap", msg)
+	}
+	waitPublish(t, m, "news", "2")
+	if msg := receiveMessage(t, sub); string(msg.Data) != "2" {
+		t.Fatalf("message = %+v, want 2", msg)
+	}
+}
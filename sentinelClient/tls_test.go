@@ -0,0 +1,185 @@
+package sentinelClient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert 测试用证书, pem为证书, key为私钥
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	kpem []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"redis.test"},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		kpem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.pem, c.kpem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSentinelClient_DialTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sentinel-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "test-ca", nil, true)
+	server := newTestCert(t, "redis.test", ca, false)
+	client := newTestCert(t, "client", ca, false)
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.cert)
+
+	// sentinel要求客户端证书, 数据节点只需要服务端证书
+	sentinel := newFakeTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    caPool,
+	}, fakeSentinel("mymaster", "10.0.0.1:6379"))
+	data := newFakeTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate(t)},
+	}, fakeRedis("master"))
+	defer sentinel.close()
+	defer data.close()
+
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+	certFile := writeFile(t, dir, "client.pem", client.pem)
+	keyFile := writeFile(t, dir, "client.key", client.kpem)
+
+	sentinelTLS, err := NewTLSConfig(caFile, certFile, keyFile, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisTLS, err := NewTLSConfig(caFile, "", "", "redis.test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &sentinelClient{options: defaultOptions}
+	if _, err = s.getMasterAddr(sentinel.addr(), "mymaster"); err == nil {
+		t.Fatal("want error dialing tls sentinel without tls")
+	}
+
+	s.options.sentinelTLSConfig = sentinelTLS
+	s.options.redisTLSConfig = redisTLS
+	if _, err = s.getMasterAddr(sentinel.addr(), "mymaster"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.verifyMasterRole(data.addr()); err != nil {
+		t.Fatal(err)
+	}
+	g := newMasterGroup("mymaster")
+	defer g.probes.close()
+	if _, err = s.probeSlave(g, data.addr(), -1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有客户端证书时sentinel拒绝
+	s.options.sentinelTLSConfig = redisTLS
+	if _, err = s.getMasterAddr(sentinel.addr(), "mymaster"); err == nil {
+		t.Fatal("want error without client certificate")
+	}
+
+	// server name不匹配
+	wrongName, err := NewTLSConfig(caFile, "", "", "other.test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.options.redisTLSConfig = wrongName
+	if err = s.verifyMasterRole(data.addr()); err == nil {
+		t.Fatal("want error for wrong server name")
+	}
+
+	// 跳过校验, 只用于测试
+	skipVerify, err := NewTLSConfig("", "", "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.options.redisTLSConfig = skipVerify
+	if err = s.verifyMasterRole(data.addr()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewTLSConfig_BadCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sentinel-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err = NewTLSConfig(writeFile(t, dir, "ca.pem", []byte("not a cert")), "", "", "", false); err != errCACert {
+		t.Fatalf("err = %v, want errCACert", err)
+	}
+}
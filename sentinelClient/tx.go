@@ -0,0 +1,119 @@
+package sentinelClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+	"gzoo/common/logger"
+)
+
+// ErrTxConflict WATCH的key被修改, 重试到上限后事务仍未执行
+var ErrTxConflict = errors.New("transaction conflict, watched keys changed")
+
+// TxFailoverError 事务执行中master不可用或发生主从切换
+// READONLY时事务没有执行, 连接在EXEC之后断开时事务可能已执行
+type TxFailoverError struct {
+	MasterName string // master-name
+	Err        error  // 原始错误
+}
+
+func (e *TxFailoverError) Error() string {
+	return fmt.Sprintf("%s transaction interrupted by failover, err:%v", e.MasterName, e.Err)
+}
+
+// Tx 事务, 回调中用Do读取WATCH的key, 用Queue把命令加入事务, 回调返回后MULTI/EXEC执行
+type Tx struct {
+	conn   redis.Conn
+	queued []batchCmd
+}
+
+// Do 立即执行命令, 用于在事务执行前读取WATCH的key
+func (tx *Tx) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return tx.conn.Do(cmd, args...)
+}
+
+// Queue 把命令加入事务, EXEC的回复按加入顺序返回
+func (tx *Tx) Queue(cmd string, args ...interface{}) {
+	tx.queued = append(tx.queued, batchCmd{name: cmd, args: args})
+}
+
+// Tx 在master上执行事务: WATCH watchKeys, 执行fn, 再MULTI/EXEC执行fn中Queue的命令, 返回EXEC的回复
+// WATCH的key被修改时重新执行fn, 超过maxTxRetries次返回ErrTxConflict
+// fn返回错误时放弃事务, master不可用或主从切换时返回*TxFailoverError
+func (s *sentinelClient) Tx(ctx context.Context, masterName string, watchKeys []string, fn func(tx *Tx) error) ([]interface{}, error) {
+	if s.isClosed() {
+		return nil, errClosed
+	}
+
+	g, err := s.getGroup(masterName)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt <= s.options.maxTxRetries; attempt++ {
+		replies, err := s.execTx(ctx, g, watchKeys, fn)
+		if err == nil && replies == nil {
+			s.options.logger.Debug("transaction conflict", logger.F("master", g.name), logger.F("attempt", attempt+1))
+			continue
+		}
+		if err != nil {
+			return nil, s.txError(g, err)
+		}
+		return replies, nil
+	}
+	return nil, ErrTxConflict
+}
+
+// execTx 执行一次事务, WATCH的key被修改时返回nil, nil
+func (s *sentinelClient) execTx(ctx context.Context, g *masterGroup, watchKeys []string, fn func(tx *Tx) error) ([]interface{}, error) {
+	// 连接归还时连接池会自动UNWATCH/DISCARD
+	conn, err := s.GetMasterClientContext(ctx, g.name)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if len(watchKeys) > 0 {
+		if _, err = conn.Do("WATCH", redis.Args{}.AddFlat(watchKeys)...); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := &Tx{conn: conn}
+	if err = fn(tx); err != nil {
+		return nil, err
+	}
+	if len(tx.queued) == 0 {
+		return []interface{}{}, nil
+	}
+
+	if err = conn.Send("MULTI"); err != nil {
+		return nil, err
+	}
+	for _, c := range tx.queued {
+		if err = conn.Send(c.name, c.args...); err != nil {
+			return nil, err
+		}
+	}
+
+	// Do返回MULTI/QUEUED中的第一个错误, 没有错误时返回EXEC的回复, WATCH的key被修改时为nil
+	reply, err := conn.Do("EXEC")
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	return redis.Values(reply, nil)
+}
+
+// txError master不可用或主从切换的错误包装为TxFailoverError
+func (s *sentinelClient) txError(g *masterGroup, err error) error {
+	kind := classifyError(err)
+	if kind == errKindNone {
+		return err
+	}
+	if kind == errKindReadOnly || kind == errKindConn {
+		s.reResolveMaster(g)
+	}
+	return &TxFailoverError{MasterName: g.name, Err: err}
+}
@@ -0,0 +1,179 @@
+package sentinelClient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// fakeTxRedis 支持WATCH/MULTI/EXEC的master, 只用于单连接测试
+type fakeTxRedis struct {
+	mutex   sync.Mutex
+	data    map[string]string
+	version map[string]int
+	watched map[string]int
+	multi   bool
+	queued  [][]string
+	execs   int
+}
+
+func newFakeTxRedis() *fakeTxRedis {
+	return &fakeTxRedis{data: map[string]string{}, version: map[string]int{}}
+}
+
+// touch 模拟其他客户端修改key
+func (r *fakeTxRedis) touch(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.version[key]++
+}
+
+func (r *fakeTxRedis) handle(args []string) interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	if r.multi && cmd != "EXEC" && cmd != "DISCARD" {
+		r.queued = append(r.queued, args)
+		return "QUEUED"
+	}
+
+	switch cmd {
+	case "WATCH":
+		if r.watched == nil {
+			r.watched = map[string]int{}
+		}
+		for _, key := range args[1:] {
+			r.watched[key] = r.version[key]
+		}
+		return "OK"
+	case "UNWATCH":
+		r.watched = nil
+		return "OK"
+	case "MULTI":
+		r.multi = true
+		return "OK"
+	case "DISCARD":
+		r.multi, r.queued, r.watched = false, nil, nil
+		return "OK"
+	case "EXEC":
+		r.execs++
+		queued, watched := r.queued, r.watched
+		r.multi, r.queued, r.watched = false, nil, nil
+		for key, v := range watched {
+			if r.version[key] != v {
+				return nil
+			}
+		}
+		replies := make([]interface{}, len(queued))
+		for i, q := range queued {
+			replies[i] = r.exec(q)
+		}
+		return replies
+	}
+	return r.exec(args)
+}
+
+func (r *fakeTxRedis) exec(args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		v, ok := r.data[args[1]]
+		if !ok {
+			return nil
+		}
+		return []byte(v)
+	case "SET":
+		r.data[args[1]] = args[2]
+		r.version[args[1]]++
+		return "OK"
+	}
+	return fakeRedis("master")(args)
+}
+
+func TestSentinelClient_Tx(t *testing.T) {
+	store := newFakeTxRedis()
+	m := newFakeServer(t, store.handle)
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr(), MaxTxRetries(2))
+	defer s.Close(context.Background())
+
+	// 第一次执行时key被其他客户端修改, 重试后成功
+	calls := 0
+	replies, err := s.Tx(context.Background(), "mymaster", []string{"k"}, func(tx *Tx) error {
+		calls++
+		v, err := redis.String(tx.Do("GET", "k"))
+		if err != nil && err != redis.ErrNil {
+			return err
+		}
+		if calls == 1 {
+			store.touch("k")
+		}
+		tx.Queue("SET", "k", v+"x")
+		tx.Queue("GET", "k")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || len(replies) != 2 || replies[0] != "OK" {
+		t.Fatalf("calls = %d, replies = %v", calls, replies)
+	}
+	if v, _ := redis.String(replies[1], nil); v != "x" {
+		t.Fatalf("value = %s, want x", v)
+	}
+
+	// 一直冲突时重试到上限
+	calls = 0
+	_, err = s.Tx(context.Background(), "mymaster", []string{"k"}, func(tx *Tx) error {
+		calls++
+		store.touch("k")
+		tx.Queue("SET", "k", "y")
+		return nil
+	})
+	if err != ErrTxConflict || calls != 3 {
+		t.Fatalf("err = %v, calls = %d, want ErrTxConflict after 3 calls", err, calls)
+	}
+
+	// 回调出错时放弃事务
+	errAbort := errors.New("abort")
+	execs := store.execs
+	if _, err = s.Tx(context.Background(), "mymaster", []string{"k"}, func(tx *Tx) error {
+		tx.Queue("SET", "k", "z")
+		return errAbort
+	}); err != errAbort || store.execs != execs {
+		t.Fatalf("err = %v, execs = %d, want abort without EXEC", err, store.execs-execs)
+	}
+}
+
+func TestSentinelClient_TxFailover(t *testing.T) {
+	// master已降为slave, 事务中的写命令返回READONLY
+	m := newFakeServer(t, func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "WATCH", "MULTI", "UNWATCH", "DISCARD":
+			return "OK"
+		case "SET":
+			return errors.New("READONLY You can't write against a read only replica.")
+		case "EXEC":
+			return errors.New("EXECABORT Transaction discarded because of previous errors.")
+		}
+		return fakeRedis("master")(args)
+	})
+	defer m.close()
+
+	s := newTestClient("mymaster", m.addr())
+	defer s.Close(context.Background())
+
+	_, err := s.Tx(context.Background(), "mymaster", []string{"k"}, func(tx *Tx) error {
+		tx.Queue("SET", "k", "v")
+		return nil
+	})
+	failover, ok := err.(*TxFailoverError)
+	if !ok || failover.MasterName != "mymaster" || classifyError(failover.Err) != errKindReadOnly {
+		t.Fatalf("err = %#v, want TxFailoverError with READONLY", err)
+	}
+}